@@ -32,7 +32,7 @@ echo ""
 
 # Build the application
 echo "Building application..."
-CGO_ENABLED=1 go build -ldflags="-w -s" -o bin/server cmd/api/main.go
+CGO_ENABLED=1 go build -ldflags="-w -s" -o bin/server ./cmd/api
 echo ""
 
 # Check if build was successful
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"spendwise-backend/internal/jobs"
+)
+
+// runCommand handles maintenance subcommands such as
+//
+//	api gc-uploads [-delete] [-grace 24h]
+func runCommand(args []string) int {
+	switch args[0] {
+	case "gc-uploads":
+		return gcUploads(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+		fmt.Fprintln(os.Stderr, "commands: gc-uploads")
+		return 2
+	}
+}
+
+func gcUploads(args []string) int {
+	flags := flag.NewFlagSet("gc-uploads", flag.ContinueOnError)
+	remove := flags.Bool("delete", false, "delete orphaned files instead of only reporting them")
+	grace := flags.Duration("grace", 24*time.Hour, "leave files younger than this alone")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	report, err := jobs.CollectOrphanedUploads(context.Background(), *grace, *remove)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gc-uploads:", err)
+		return 1
+	}
+
+	for _, obj := range report.Orphans {
+		fmt.Printf("%s\t%d\t%s\n", obj.Key, obj.Size, obj.ModTime.Format(time.RFC3339))
+	}
+	fmt.Printf("\nScanned %d files: %d orphaned (%d bytes), %d within the %s grace period\n",
+		report.Scanned, len(report.Orphans), report.OrphanBytes(), report.Recent, *grace)
+	if *remove {
+		fmt.Printf("Deleted %d, failed %d\n", report.Deleted, report.Failed)
+	} else if len(report.Orphans) > 0 {
+		fmt.Println("Run with -delete to remove them")
+	}
+
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
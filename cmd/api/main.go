@@ -3,10 +3,16 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
 	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/ratelimit"
 	"spendwise-backend/internal/routes"
+	"spendwise-backend/internal/services/mail"
+	"spendwise-backend/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -26,8 +32,35 @@ func main() {
 	// Run Migrations
 	models.Migrate(database.DB)
 
+	// File Storage
+	storage.Connect()
+
+	// Rate Limit Counters
+	ratelimit.Connect(database.DB)
+
+	// Maintenance subcommands run once and exit
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	// Outgoing Mail
+	mail.Connect()
+
+	// Background Jobs
+	jobs.Every("approval-escalation", jobs.IntervalFromEnv("ESCALATION_INTERVAL", 15*time.Minute), jobs.EscalateOverdueExpenses)
+	jobs.Every("recurring-expenses", jobs.IntervalFromEnv("RECURRING_INTERVAL", time.Minute), jobs.GenerateRecurringExpenses)
+	jobs.Every("rate-limit-cleanup", 10*time.Minute, ratelimit.CleanupJob)
+	jobs.Every("receipt-ocr", jobs.IntervalFromEnv("OCR_INTERVAL", 5*time.Second), jobs.ExtractPendingReceipts)
+	jobs.Every("upload-gc", jobs.IntervalFromEnv("UPLOAD_GC_INTERVAL", 24*time.Hour), jobs.CollectOrphanedUploadsJob)
+
 	// Initialize Fiber
-	app := fiber.New()
+	// Per-file limits are enforced by the upload pipeline; this only caps
+	// whole requests such as an expense with several receipts
+	config := fiber.Config{
+		BodyLimit: 50 * 1024 * 1024,
+	}
+	trustProxies(&config)
+	app := fiber.New(config)
 
 	// Middleware
 	app.Use(logger.New())
@@ -39,10 +72,6 @@ func main() {
 	// Routes
 	routes.SetupRoutes(app)
 
-	// Static files for uploads
-	// Static files for uploads
-	app.Static("/uploads", "./uploads")
-
 	// Serve Frontend Static Files
 	// Assuming the frontend is built to ../dist relative to the backend execution context
 	app.Static("/", "../dist")
@@ -65,3 +94,30 @@ func main() {
 	}
 	log.Fatal(app.Listen(":" + port))
 }
+
+// trustProxies makes c.IP(), which rate limits and sessions key on, the
+// client address reported by a reverse proxy. TRUSTED_PROXIES lists the
+// proxies' addresses or CIDR ranges; requests from anywhere else keep their
+// own address, so nobody can pick an IP by sending the header directly.
+// PROXY_HEADER (default X-Real-IP) must be set, not appended to, by the
+// proxy: with X-Forwarded-For its first address would be the client's own.
+func trustProxies(config *fiber.Config) {
+	var proxies []string
+	for _, p := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	if len(proxies) == 0 {
+		return
+	}
+
+	config.ProxyHeader = os.Getenv("PROXY_HEADER")
+	if config.ProxyHeader == "" {
+		config.ProxyHeader = "X-Real-IP"
+	}
+	config.EnableTrustedProxyCheck = true
+	config.TrustedProxies = proxies
+	config.EnableIPValidation = true
+	log.Printf("Client IPs: %s from %s", config.ProxyHeader, strings.Join(proxies, ", "))
+}
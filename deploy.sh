@@ -35,6 +35,22 @@ JWT_SECRET=your_super_secret_jwt_key_change_this_in_production
 # Server Configuration
 PORT=8080
 
+# Reverse proxy: addresses or CIDR ranges of the proxies in front of the
+# server, comma-separated. Rate limits and sessions then use the client IP
+# from PROXY_HEADER, which the proxy must overwrite on every request
+# (nginx: proxy_set_header X-Real-IP $remote_addr). Leave empty when clients
+# connect directly.
+TRUSTED_PROXIES=
+PROXY_HEADER=X-Real-IP
+
+# Mail: smtp in production ("file" or "console" for development)
+MAIL_DRIVER=smtp
+MAIL_FROM=SpendWise <no-reply@example.com>
+SMTP_HOST=smtp.example.com
+SMTP_PORT=587
+SMTP_USERNAME=your_smtp_user
+SMTP_PASSWORD=your_smtp_password
+
 # SlipOK API (if using)
 SLIPOK_API_KEY=your_slipok_api_key
 EOF
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// exportMembership is one group in a data export.
+type exportMembership struct {
+	GroupID   uint      `json:"group_id"`
+	GroupName string    `json:"group_name"`
+	JoinedAt  time.Time `json:"joined_at"`
+	Roles     []string  `json:"roles"`
+}
+
+// zipName keeps a user-supplied filename from escaping its folder in the
+// archive.
+func zipName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == '/' || r == '\\' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, path.Base(name))
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeZipFile(zw *zip.Writer, name, key string) error {
+	r, err := storage.Files.Get(context.Background(), key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// ExportAccount streams a zip of everything stored about the user: profile,
+// group memberships, expenses with their receipts, splits, settlements and
+// wallet transactions.
+func ExportAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	var members []models.GroupMember
+	var roles []models.UserRole
+	expenses := make([]models.ExpenseRequest, 0)
+	attachments := make([]models.ExpenseAttachment, 0)
+	splits := make([]models.ExpenseSplit, 0)
+	settlements := make([]models.Settlement, 0)
+	transactions := make([]models.WalletTransaction, 0)
+	identities := make([]models.UserIdentity, 0)
+
+	err := database.DB.Preload("Group").Where("user_id = ?", userID).Find(&members).Error
+	if err == nil {
+		err = database.DB.Where("user_id = ?", userID).Find(&roles).Error
+	}
+	if err == nil {
+		err = database.DB.Preload("Tags").Preload("FieldValues").Preload("Splits").Preload("AuditLogs").
+			Where("requester_id = ?", userID).Order("created_at").Find(&expenses).Error
+	}
+	if err == nil {
+		err = database.DB.Where("uploaded_by = ? OR expense_id IN (?)", userID,
+			database.DB.Model(&models.ExpenseRequest{}).Select("id").Where("requester_id = ?", userID)).
+			Order("id").Find(&attachments).Error
+	}
+	if err == nil {
+		err = database.DB.Where("user_id = ?", userID).Order("created_at").Find(&splits).Error
+	}
+	if err == nil {
+		err = database.DB.Where("from_user_id = ? OR to_user_id = ?", userID, userID).Order("created_at").Find(&settlements).Error
+	}
+	if err == nil {
+		err = database.DB.Where("user_id = ?", userID).Order("created_at").Find(&transactions).Error
+	}
+	if err == nil {
+		err = database.DB.Where("user_id = ?", userID).Find(&identities).Error
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not collect account data"})
+	}
+
+	memberships := make([]exportMembership, 0, len(members))
+	for _, m := range members {
+		membership := exportMembership{GroupID: m.GroupID, GroupName: m.Group.Name, JoinedAt: m.JoinedAt, Roles: []string{}}
+		for _, r := range roles {
+			if r.GroupID == m.GroupID {
+				membership.Roles = append(membership.Roles, r.Role)
+			}
+		}
+		memberships = append(memberships, membership)
+	}
+
+	// Receipts go in the archive; the listing points at them
+	files := make(map[string]string, len(attachments))
+	for i := range attachments {
+		name := fmt.Sprintf("attachments/%d_%s", attachments[i].ID, zipName(attachments[i].FileName))
+		files[name] = attachments[i].FilePath
+		attachments[i].URL = name
+	}
+	if key, ok := models.UploadKey(user.AvatarURL); ok {
+		files["avatar"+path.Ext(key)] = key
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="spendwise-export-%s.zip"`, time.Now().Format("2006-01-02")))
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	// The archive is streamed, so a failure part-way can only be logged
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		zw := zip.NewWriter(w)
+		documents := []struct {
+			name string
+			v    interface{}
+		}{
+			{"profile.json", fiber.Map{"user": user, "linked_accounts": identities}},
+			{"memberships.json", memberships},
+			{"expenses.json", expenses},
+			{"attachments.json", attachments},
+			{"splits.json", splits},
+			{"settlements.json", settlements},
+			{"wallet_transactions.json", transactions},
+		}
+		for _, d := range documents {
+			if err := writeZipJSON(zw, d.name, d.v); err != nil {
+				log.Printf("Data export for user %d failed: %v", userID, err)
+				return
+			}
+		}
+		for name, key := range files {
+			if err := writeZipFile(zw, name, key); err != nil {
+				log.Printf("Data export for user %d skipped %s: %v", userID, key, err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			log.Printf("Data export for user %d failed: %v", userID, err)
+		}
+	})
+	return nil
+}
+
+// soleAdminGroups lists groups with other members in which the user is the
+// only admin; those would be left without anyone to manage them.
+func soleAdminGroups(userID uint) ([]string, error) {
+	var names []string
+	err := database.DB.Model(&models.ExpenseGroup{}).
+		Joins("JOIN user_roles ON user_roles.group_id = expense_groups.id AND user_roles.user_id = ? AND user_roles.role = 'admin'", userID).
+		Where("NOT EXISTS (SELECT 1 FROM user_roles o WHERE o.group_id = expense_groups.id AND o.role = 'admin' AND o.user_id <> ?)", userID).
+		Where("EXISTS (SELECT 1 FROM group_members m WHERE m.group_id = expense_groups.id AND m.user_id <> ?)", userID).
+		Pluck("expense_groups.name", &names).Error
+	return names, err
+}
+
+// DeleteAccount anonymizes the user. The row and its group memberships stay
+// so that expenses, splits, settlements and wallet transactions in shared
+// groups still add up; everything that identifies the person or lets anyone
+// sign in as them is removed, along with their roles, and pending approvals
+// waiting on them go back to the group.
+func DeleteAccount(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	type DeleteAccountRequest struct {
+		Password     string `json:"password" validate:"max=200"`      // Required unless the account signs in with SSO only
+		ConfirmEmail string `json:"confirm_email" validate:"max=255"` // Required instead of a password for SSO-only accounts
+		Code         string `json:"code" validate:"max=10"`
+		RecoveryCode string `json:"recovery_code" validate:"max=20"`
+	}
+
+	var req DeleteAccountRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	if user.PasswordHash != "" {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid password"})
+		}
+	} else if !strings.EqualFold(strings.TrimSpace(req.ConfirmEmail), user.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Type your email address to confirm"})
+	}
+
+	names, err := soleAdminGroups(userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not check group roles"})
+	}
+	if len(names) > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":  "Make someone else an admin of these groups first",
+			"groups": names,
+		})
+	}
+
+	tx := database.DB.Begin()
+
+	if user.TOTPEnabledAt != nil && !checkSecondFactor(tx, &user, req.Code, req.RecoveryCode) {
+		tx.Rollback()
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid authentication code"})
+	}
+
+	avatarURL := user.AvatarURL
+	now := time.Now()
+	err = tx.Model(&user).Updates(map[string]interface{}{
+		"email":           fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+		"full_name":       "Deleted user",
+		"phone":           "",
+		"avatar_url":      "",
+		"password_hash":   "",
+		"verified_at":     nil,
+		"totp_secret":     "",
+		"totp_enabled_at": nil,
+		"anonymized_at":   now,
+	}).Error
+	if err == nil {
+		err = invalidateUserTokens(tx, &user)
+	}
+	for _, model := range []interface{}{&models.UserIdentity{}, &models.RecoveryCode{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}} {
+		if err == nil {
+			err = tx.Where("user_id = ?", userID).Delete(model).Error
+		}
+	}
+	// Nothing should keep acting for or on behalf of the account
+	if err == nil {
+		err = tx.Model(&models.RecurringExpense{}).Where("requester_id = ?", userID).Update("is_active", false).Error
+	}
+	if err == nil {
+		err = tx.Where("user_id = ?", userID).Delete(&models.UserRole{}).Error
+	}
+	if err == nil {
+		err = tx.Model(&models.ExpenseRequest{}).Where("target_user_id = ? AND status = ?", userID, "pending").Update("target_user_id", nil).Error
+	}
+	if err == nil {
+		// Escalations without a named approver go to the group admins
+		err = tx.Model(&models.ExpenseRequest{}).Where("escalated_to_id = ? AND status = ?", userID, "pending").Update("escalated_to_id", nil).Error
+	}
+	if err == nil {
+		err = tx.Model(&models.RecurringExpense{}).Where("target_user_id = ?", userID).Update("target_user_id", nil).Error
+	}
+	if err == nil {
+		err = tx.Model(&models.ExpenseGroup{}).Where("fallback_approver_id = ?", userID).Update("fallback_approver_id", nil).Error
+	}
+	if err == nil {
+		err = tx.Model(&models.ApprovalDelegation{}).
+			Where("(delegator_id = ? OR delegate_id = ?) AND ends_at > ?", userID, userID, now).
+			Update("ends_at", now).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete account"})
+	}
+
+	tx.Commit()
+
+	if key, ok := models.UploadKey(avatarURL); ok {
+		for _, k := range upload.AvatarKeys(key) {
+			storage.Files.Delete(context.Background(), k)
+		}
+	}
+
+	return c.JSON(fiber.Map{"message": "Account deleted"})
+}
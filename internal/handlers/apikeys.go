@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" validate:"required,max=100"`
+	Scopes    []string   `json:"scopes" validate:"required,max=10"`
+	GroupID   *uint      `json:"group_id"`   // Optional; restricts the key to one group
+	ExpiresAt *time.Time `json:"expires_at"` // Optional; the key never expires otherwise
+}
+
+func (r *createAPIKeyRequest) Normalize() {
+	r.Name = strings.TrimSpace(r.Name)
+}
+
+// apiKeyGroup returns the group the request's API key is restricted to.
+func apiKeyGroup(c *fiber.Ctx) (uint, bool) {
+	groupID, ok := c.Locals("api_key_group_id").(uint)
+	return groupID, ok
+}
+
+// apiKeyAllowsGroup is false when the request was made with an API key
+// restricted to another group.
+func apiKeyAllowsGroup(c *fiber.Ctx, groupID uint) bool {
+	restricted, ok := apiKeyGroup(c)
+	return !ok || restricted == groupID
+}
+
+func apiKeyGroupDenied(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This API key is restricted to another group"})
+}
+
+// apiKeyTwoFactorError refuses API keys in groups that require 2FA. A key
+// never passes a second factor, so it cannot stand in for one.
+func apiKeyTwoFactorError(c *fiber.Ctx, groupID uint) *fiber.Error {
+	if _, viaKey := c.Locals("api_key_id").(uint); !viaKey {
+		return nil
+	}
+	if !groupRequiresTwoFactor(groupID) {
+		return nil
+	}
+	return fiber.NewError(fiber.StatusForbidden, "This group requires two-factor authentication, which API keys cannot provide")
+}
+
+// ListAPIKeys returns the user's API keys that have not been revoked.
+func ListAPIKeys(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	keys := make([]models.APIKey, 0)
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").Find(&keys).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch API keys"})
+	}
+
+	return c.JSON(keys)
+}
+
+// CreateAPIKey issues a new API key. The key itself is only in this
+// response.
+func CreateAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var req createAPIKeyRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	known := models.APIKey{Scopes: models.APIKeyScopes}
+	for _, scope := range req.Scopes {
+		if !known.HasScope(scope) {
+			return badRequest(c, validation.Errors{"scopes": "must be among: " + strings.Join(models.APIKeyScopes, ", ")})
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return badRequest(c, validation.Errors{"expires_at": "must be in the future"})
+	}
+	if req.GroupID != nil {
+		var member models.GroupMember
+		if err := database.DB.Where("group_id = ? AND user_id = ?", *req.GroupID, userID).First(&member).Error; err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+		}
+	}
+
+	key := models.APIKeyPrefix + randomToken(32)
+	apiKey := models.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    key[:len(models.APIKeyPrefix)+6],
+		KeyHash:   models.HashAPIKey(key),
+		Scopes:    req.Scopes,
+		GroupID:   req.GroupID,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := database.DB.Create(&apiKey).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create API key"})
+	}
+
+	return c.JSON(fiber.Map{
+		"api_key": apiKey,
+		"key":     key,
+	})
+}
+
+// RevokeAPIKey stops a key from working. It stays in the database so its
+// last use can still be looked up.
+func RevokeAPIKey(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key ID"})
+	}
+
+	result := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke API key"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "API key revoked"})
+}
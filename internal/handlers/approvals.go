@@ -1,17 +1,20 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
 	"time"
 
 	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
 	"spendwise-backend/internal/models"
 	"spendwise-backend/internal/services/slipok"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 func ListApprovals(c *fiber.Ctx) error {
@@ -19,7 +22,11 @@ func ListApprovals(c *fiber.Ctx) error {
 
 	// Find groups where user is approver or admin
 	var roles []models.UserRole
-	if err := database.DB.Where("user_id = ? AND role IN ?", userID, []string{"approver", "admin", "requester"}).Find(&roles).Error; err != nil {
+	query := database.DB.Where("user_id = ? AND role IN ?", userID, []string{"approver", "admin", "requester"})
+	if restricted, ok := apiKeyGroup(c); ok {
+		query = query.Where("group_id = ?", restricted)
+	}
+	if err := query.Find(&roles).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch roles"})
 	}
 
@@ -38,6 +45,29 @@ func ListApprovals(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch pending approvals"})
 	}
 
+	var groups []models.ExpenseGroup
+	database.DB.Where("id IN ?", groupIDs).Find(&groups)
+	groupByID := make(map[uint]models.ExpenseGroup)
+	for _, g := range groups {
+		groupByID[g.ID] = g
+	}
+
+	now := time.Now()
+	for i := range expenses {
+		// Flag which requests this user can decide, including ones delegated to them
+		onBehalfOf, ok := resolveDecider(&expenses[i], userID)
+		expenses[i].CanDecide = ok
+		expenses[i].ActingOnBehalfOf = onBehalfOf
+
+		// SLA tracking
+		expenses[i].AgeHours = now.Sub(expenses[i].CreatedAt).Hours()
+		group := groupByID[expenses[i].GroupID]
+		if dueAt, hasSLA := group.ApprovalDeadline(expenses[i].CreatedAt); hasSLA {
+			expenses[i].DueAt = &dueAt
+			expenses[i].IsOverdue = now.After(dueAt)
+		}
+	}
+
 	return c.JSON(expenses)
 }
 
@@ -45,21 +75,26 @@ func ApproveExpense(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 	expenseID := c.Params("id")
 
+	// Sent as JSON, or as multipart/form-data with a payment slip under "file"
 	type ApproveRequest struct {
-		Notes string `json:"notes"`
+		Notes string `json:"notes" form:"notes" validate:"max=2000"`
 	}
-	// Note: For file upload, we might need to handle form data differently,
-	// but for simplicity assuming separate upload or just notes here if no file.
-	// If file is present, it should be handled similar to UploadAttachment but for approval_slips.
 
 	var req ApproveRequest
-	// Try parsing body if JSON, but if multipart it might fail or be empty.
-	c.BodyParser(&req)
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
 
 	var expense models.ExpenseRequest
 	if err := database.DB.First(&expense, expenseID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
 	}
+	if !apiKeyAllowsGroup(c, expense.GroupID) {
+		return apiKeyGroupDenied(c)
+	}
+	if expense.Status != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Expense has already been decided"})
+	}
 
 	// Verify permission
 	var role models.UserRole
@@ -68,12 +103,18 @@ func ApproveExpense(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
 	}
 
-	// Enforce Specific Approver if set
-	if expense.TargetUserID != nil {
-		if *expense.TargetUserID != userID {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the assigned approver can approve this expense"})
-		}
-	} else {
+	// Enforce Specific Approver (or their active delegate) if set
+	onBehalfOf, allowed := resolveDecider(&expense, userID)
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the assigned approver can approve this expense"})
+	}
+	if e := decisionTwoFactorError(userID, expense.GroupID); e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message, "code": "two_factor_required"})
+	}
+	if e := apiKeyTwoFactorError(c, expense.GroupID); e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message, "code": "two_factor_required"})
+	}
+	if expense.TargetUserID == nil {
 		// If no specific approver, anyone in the group can approve.
 		// Optional: Block requester from approving their own request?
 		// The requirement didn't specify blocking self-approval, but it's good practice.
@@ -86,45 +127,51 @@ func ApproveExpense(c *fiber.Ctx) error {
 		}
 	}
 
+	// Budgets are checked before anything is written
+	alerts, blocked := jobs.CheckBudgets(&expense)
+	if blocked {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Budget limit exceeded", "budget_alerts": alerts})
+	}
+
 	// Handle Slip Upload if present
 	file, err := c.FormFile("file")
 	if err == nil {
-		uploadDir := "./uploads"
-		if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-			os.Mkdir(uploadDir, 0755)
+		stored, err := storeUpload(file, upload.Slip, "slips", 0)
+		if err != nil {
+			return uploadError(c, err)
+		}
+		slip := models.ApprovalSlip{
+			ExpenseID:  expense.ID,
+			FileName:   stored.Name,
+			FilePath:   stored.Key,
+			FileSize:   stored.Size,
+			FileType:   stored.ContentType,
+			Notes:      c.FormValue("notes"),
+			UploadedBy: userID,
+			UploadedAt: time.Now(),
 		}
-		filename := fmt.Sprintf("slip_%d_%d_%s", userID, time.Now().Unix(), file.Filename)
-		filePath := filepath.Join(uploadDir, filename)
-
-		if err := c.SaveFile(file, filePath); err == nil {
-			slip := models.ApprovalSlip{
-				ExpenseID:  expense.ID,
-				FileName:   file.Filename,
-				FilePath:   "/uploads/" + filename,
-				FileSize:   file.Size,
-				FileType:   file.Header.Get("Content-Type"),
-				Notes:      c.FormValue("notes"),
-				UploadedBy: userID,
-				UploadedAt: time.Now(),
-			}
-
-			// Verify with SlipOK
-			// We do this synchronously to ensure we capture the result before responding
-			// In a production high-load env, this might be better as a background job,
-			// but for this use case, immediate feedback is valuable.
-			resp, err := slipok.VerifySlip(filePath)
-			if err == nil && resp.Success && resp.Data.Success {
-				slip.IsVerified = true
-
-				// Marshal relevant data to JSON string
-				dataBytes, _ := json.Marshal(resp.Data)
-				slip.SlipOKData = string(dataBytes)
-			} else if err != nil {
-				fmt.Printf("SlipOK Verification Failed: %v\n", err)
-			}
-
-			database.DB.Create(&slip)
+
+		// Verify with SlipOK
+		// We do this synchronously to ensure we capture the result before responding
+		// In a production high-load env, this might be better as a background job,
+		// but for this use case, immediate feedback is valuable.
+		var resp *slipok.SlipOKResponse
+		err = storage.WithLocalFile(context.Background(), storage.Files, stored.Key, func(filePath string) error {
+			var err error
+			resp, err = slipok.VerifySlip(filePath)
+			return err
+		})
+		if err == nil && resp.Success && resp.Data.Success {
+			slip.IsVerified = true
+
+			// Marshal relevant data to JSON string
+			dataBytes, _ := json.Marshal(resp.Data)
+			slip.SlipOKData = string(dataBytes)
+		} else if err != nil {
+			fmt.Printf("SlipOK Verification Failed: %v\n", err)
 		}
+
+		database.DB.Create(&slip)
 	}
 
 	// Update Status
@@ -132,22 +179,22 @@ func ApproveExpense(c *fiber.Ctx) error {
 	expense.Status = "approved"
 	expense.ApprovedBy = &userID
 	expense.ApprovedAt = &now
-
-	// Deduct from Approver's Wallet
-	var approver models.User
-	if err := database.DB.First(&approver, userID).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not find approver"})
-	}
-
-	approver.WalletBalance -= expense.Amount
+	expense.OnBehalfOfID = onBehalfOf
 
 	tx := database.DB.Begin()
-	if err := tx.Save(&expense).Error; err != nil {
+	claimed, err := claimPendingExpense(tx, &expense)
+	if err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not approve expense"})
 	}
+	if !claimed {
+		tx.Rollback()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Expense has already been decided"})
+	}
 
-	if err := tx.Save(&approver).Error; err != nil {
+	// Deduct from Approver's Wallet
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		Update("wallet_balance", gorm.Expr("wallet_balance - ?", expense.Amount)).Error; err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update wallet balance"})
 	}
@@ -167,8 +214,22 @@ func ApproveExpense(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create transaction record"})
 	}
 
+	audit := models.ExpenseAuditLog{
+		ExpenseID:    expense.ID,
+		Action:       "approved",
+		ActorID:      userID,
+		OnBehalfOfID: onBehalfOf,
+		Message:      auditMessage(tx, "approved", userID, onBehalfOf),
+		CreatedAt:    now,
+	}
+	if err := tx.Create(&audit).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create audit record"})
+	}
+
 	tx.Commit()
 
+	expense.BudgetWarnings = alerts
 	return c.JSON(expense)
 }
 
@@ -177,18 +238,24 @@ func RejectExpense(c *fiber.Ctx) error {
 	expenseID := c.Params("id")
 
 	type RejectRequest struct {
-		Reason string `json:"reason"`
+		Reason string `json:"reason" validate:"max=1000"`
 	}
 
 	var req RejectRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	var expense models.ExpenseRequest
 	if err := database.DB.First(&expense, expenseID).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
 	}
+	if !apiKeyAllowsGroup(c, expense.GroupID) {
+		return apiKeyGroupDenied(c)
+	}
+	if expense.Status != "pending" {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Expense has already been decided"})
+	}
 
 	// Verify permission
 	var role models.UserRole
@@ -197,11 +264,16 @@ func RejectExpense(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
 	}
 
-	// Enforce Specific Approver if set
-	if expense.TargetUserID != nil {
-		if *expense.TargetUserID != userID {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the assigned approver can reject this expense"})
-		}
+	// Enforce Specific Approver (or their active delegate) if set
+	onBehalfOf, allowed := resolveDecider(&expense, userID)
+	if !allowed {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only the assigned approver can reject this expense"})
+	}
+	if e := decisionTwoFactorError(userID, expense.GroupID); e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message, "code": "two_factor_required"})
+	}
+	if e := apiKeyTwoFactorError(c, expense.GroupID); e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message, "code": "two_factor_required"})
 	}
 
 	// Update Status
@@ -210,10 +282,44 @@ func RejectExpense(c *fiber.Ctx) error {
 	expense.ApprovedBy = &userID
 	expense.ApprovedAt = &now
 	expense.RejectionReason = req.Reason
+	expense.OnBehalfOfID = onBehalfOf
 
-	if err := database.DB.Save(&expense).Error; err != nil {
+	tx := database.DB.Begin()
+	claimed, err := claimPendingExpense(tx, &expense)
+	if err != nil {
+		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not reject expense"})
 	}
+	if !claimed {
+		tx.Rollback()
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Expense has already been decided"})
+	}
+
+	audit := models.ExpenseAuditLog{
+		ExpenseID:    expense.ID,
+		Action:       "rejected",
+		ActorID:      userID,
+		OnBehalfOfID: onBehalfOf,
+		Message:      auditMessage(tx, "rejected", userID, onBehalfOf),
+		CreatedAt:    now,
+	}
+	if err := tx.Create(&audit).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create audit record"})
+	}
+
+	tx.Commit()
 
 	return c.JSON(expense)
 }
+
+// claimPendingExpense writes the decision on an expense only while it is
+// still pending, so two deciders racing each other cannot both succeed. It
+// reports false when the expense was decided first by someone else.
+func claimPendingExpense(tx *gorm.DB, expense *models.ExpenseRequest) (bool, error) {
+	res := tx.Model(expense).
+		Where("status = ?", "pending").
+		Select("status", "approved_by", "approved_at", "rejection_reason", "on_behalf_of_id").
+		Updates(expense)
+	return res.RowsAffected == 1, res.Error
+}
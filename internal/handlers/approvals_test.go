@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/split"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func approvalTestApp() *fiber.App {
+	app := setupApp()
+	app.Post("/approvals/:id/approve", asTestUser, ApproveExpense)
+	app.Post("/approvals/:id/reject", asTestUser, RejectExpense)
+	return app
+}
+
+func decide(t *testing.T, app *fiber.App, action string, expenseID, userID uint) (int, string) {
+	status, body := sendAs(t, app, "POST", fmt.Sprintf("/approvals/%d/%s", expenseID, action), userID, strings.NewReader("{}"))
+	return status, string(body)
+}
+
+func TestDecisionsRequireTwoFactor(t *testing.T) {
+	setupTestDB()
+	app := approvalTestApp()
+
+	admin := createTestUser("strict-admin@example.com", true)
+	requester := createTestUser("strict-requester@example.com", false)
+	colleague := createTestUser("strict-colleague@example.com", false)
+	delegate := createTestUser("strict-delegate@example.com", false)
+	group := createTestGroup("strict", true, admin, map[uint]string{
+		admin.ID:     "admin",
+		requester.ID: "requester",
+		colleague.ID: "requester",
+		delegate.ID:  "requester",
+	})
+
+	t.Run("Requester On An Untargeted Expense", func(t *testing.T) {
+		expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: colleague.ID, Title: "Lunch", Category: "Food", Amount: 20, Status: "pending"}
+		database.DB.Create(&expense)
+
+		status, body := decide(t, app, "approve", expense.ID, requester.ID)
+		assert.Equal(t, 403, status)
+		assert.Contains(t, body, "two_factor_required")
+
+		status, _ = decide(t, app, "reject", expense.ID, requester.ID)
+		assert.Equal(t, 403, status)
+	})
+
+	t.Run("Delegate On Behalf Of The Approver", func(t *testing.T) {
+		database.DB.Create(&models.ApprovalDelegation{
+			DelegatorID: admin.ID,
+			DelegateID:  delegate.ID,
+			StartsAt:    time.Now().Add(-time.Hour),
+			EndsAt:      time.Now().Add(time.Hour),
+		})
+		expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: colleague.ID, Title: "Hotel", Category: "Travel", Amount: 120, Status: "pending", TargetUserID: &admin.ID}
+		database.DB.Create(&expense)
+
+		status, body := decide(t, app, "approve", expense.ID, delegate.ID)
+		assert.Equal(t, 403, status)
+		assert.Contains(t, body, "two_factor_required")
+
+		database.DB.First(&expense, expense.ID)
+		assert.Equal(t, "pending", expense.Status)
+	})
+}
+
+func TestDeletedApproverHandsBackApprovals(t *testing.T) {
+	setupTestDB()
+	app := approvalTestApp()
+	app.Delete("/auth/me", asTestUser, DeleteAccount)
+
+	admin := createTestUser("handover-admin@example.com", false)
+	requester := createTestUser("handover-requester@example.com", false)
+	leaving := createTestUser("handover-leaving@example.com", false)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	database.DB.Model(&leaving).Update("password_hash", string(hash))
+	group := createTestGroup("handover", false, admin, map[uint]string{
+		admin.ID:     "admin",
+		requester.ID: "requester",
+		leaving.ID:   "approver",
+	})
+	database.DB.Model(&group).Update("fallback_approver_id", leaving.ID)
+
+	expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: requester.ID, Title: "Taxi", Amount: 20, Status: "pending", TargetUserID: &leaving.ID}
+	database.DB.Create(&expense)
+
+	status, _ := sendAs(t, app, "DELETE", "/auth/me", leaving.ID, strings.NewReader(`{"password": "password123"}`))
+	assert.Equal(t, 200, status)
+
+	database.DB.First(&expense, expense.ID)
+	assert.Nil(t, expense.TargetUserID)
+	database.DB.First(&group, group.ID)
+	assert.Nil(t, group.FallbackApproverID)
+
+	var roles int64
+	database.DB.Model(&models.UserRole{}).Where("user_id = ?", leaving.ID).Count(&roles)
+	assert.Equal(t, int64(0), roles)
+
+	// The membership stays for the ledger, but nobody can pick the account
+	assert.Equal(t, int64(0), activeMemberCount(group.ID, []uint{leaving.ID}))
+	_, msg := buildSplits(group.ID, 20, &SplitRequest{Method: "equal", Participants: []split.Participant{{UserID: requester.ID}, {UserID: leaving.ID}}})
+	assert.NotEmpty(t, msg)
+}
+
+func TestDelegatedDecisions(t *testing.T) {
+	setupTestDB()
+	app := approvalTestApp()
+
+	approver := createTestUser("away-approver@example.com", false)
+	requester := createTestUser("away-requester@example.com", false)
+	delegate := createTestUser("away-delegate@example.com", false)
+	group := createTestGroup("away", false, approver, map[uint]string{
+		approver.ID:  "approver",
+		requester.ID: "requester",
+		delegate.ID:  "requester",
+	})
+
+	newExpense := func(title string) models.ExpenseRequest {
+		expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: requester.ID, Title: title, Category: "Travel", Amount: 80, Status: "pending", TargetUserID: &approver.ID}
+		database.DB.Create(&expense)
+		return expense
+	}
+
+	t.Run("On Behalf Of The Approver", func(t *testing.T) {
+		delegation := models.ApprovalDelegation{DelegatorID: approver.ID, DelegateID: delegate.ID, StartsAt: time.Now().Add(-time.Hour), EndsAt: time.Now().Add(time.Hour)}
+		database.DB.Create(&delegation)
+		defer database.DB.Delete(&delegation)
+
+		expense := newExpense("Train")
+		status, body := decide(t, app, "approve", expense.ID, delegate.ID)
+		assert.Equal(t, 200, status, body)
+
+		database.DB.First(&expense, expense.ID)
+		assert.Equal(t, "approved", expense.Status)
+		assert.Equal(t, delegate.ID, *expense.ApprovedBy)
+		if assert.NotNil(t, expense.OnBehalfOfID) {
+			assert.Equal(t, approver.ID, *expense.OnBehalfOfID)
+		}
+
+		var audit models.ExpenseAuditLog
+		database.DB.Where("expense_id = ?", expense.ID).First(&audit)
+		assert.Equal(t, "approved by away-delegate on behalf of away-approver", audit.Message)
+	})
+
+	t.Run("Expired Delegation", func(t *testing.T) {
+		database.DB.Create(&models.ApprovalDelegation{DelegatorID: approver.ID, DelegateID: delegate.ID, StartsAt: time.Now().Add(-48 * time.Hour), EndsAt: time.Now().Add(-24 * time.Hour)})
+
+		expense := newExpense("Flight")
+		status, _ := decide(t, app, "approve", expense.ID, delegate.ID)
+		assert.Equal(t, 403, status)
+		status, _ = decide(t, app, "reject", expense.ID, delegate.ID)
+		assert.Equal(t, 403, status)
+
+		database.DB.First(&expense, expense.ID)
+		assert.Equal(t, "pending", expense.Status)
+	})
+}
+
+func TestDecisionsOnlyOnce(t *testing.T) {
+	setupTestDB()
+	app := approvalTestApp()
+
+	approver := createTestUser("once-approver@example.com", false)
+	requester := createTestUser("once-requester@example.com", false)
+	group := createTestGroup("once", false, approver, map[uint]string{
+		approver.ID:  "admin",
+		requester.ID: "requester",
+	})
+
+	expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: requester.ID, Title: "Hotel", Category: "Travel", Amount: 50, Status: "pending"}
+	database.DB.Create(&expense)
+
+	status, body := decide(t, app, "approve", expense.ID, approver.ID)
+	assert.Equal(t, 200, status, body)
+
+	status, _ = decide(t, app, "approve", expense.ID, approver.ID)
+	assert.Equal(t, 409, status)
+	status, _ = decide(t, app, "reject", expense.ID, approver.ID)
+	assert.Equal(t, 409, status)
+
+	database.DB.First(&expense, expense.ID)
+	assert.Equal(t, "approved", expense.Status)
+
+	// The wallet is debited, and the decision recorded, only once
+	var debits, audits int64
+	database.DB.Model(&models.WalletTransaction{}).Where("reference_id = ? AND type = ?", expense.ID, "debit").Count(&debits)
+	assert.Equal(t, int64(1), debits)
+	database.DB.Model(&models.ExpenseAuditLog{}).Where("expense_id = ?", expense.ID).Count(&audits)
+	assert.Equal(t, int64(1), audits)
+	database.DB.First(&approver, approver.ID)
+	assert.Equal(t, float64(-50), approver.WalletBalance)
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// loadEditableExpense fetches an expense whose attachments the user may
+// change: only the requester, and only while it is pending.
+func loadEditableExpense(expenseID interface{}, userID uint) (*models.ExpenseRequest, error) {
+	var expense models.ExpenseRequest
+	if err := database.DB.First(&expense, expenseID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Expense not found")
+	}
+	if expense.RequesterID != userID {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Only the requester can manage attachments")
+	}
+	if expense.Status != "pending" {
+		return nil, fiber.NewError(fiber.StatusConflict, "Attachments are locked once the expense has been decided")
+	}
+	return &expense, nil
+}
+
+// findDuplicateAttachment returns an attachment of the expense with the same
+// content, other than exceptID.
+func findDuplicateAttachment(expenseID uint, hash string, exceptID uint) *models.ExpenseAttachment {
+	var existing models.ExpenseAttachment
+	if err := database.DB.Where("expense_id = ? AND sha256 = ? AND id <> ?", expenseID, hash, exceptID).First(&existing).Error; err != nil {
+		return nil
+	}
+	return &existing
+}
+
+// errUploadReleased means a shared upload lost its last attachment, and so
+// its stored objects, before the new attachment referring to it was saved.
+var errUploadReleased = errors.New("shared upload was released")
+
+// lockObjects serializes adding and dropping references to the stored
+// objects until tx ends, so a shared object is never deleted while a new
+// attachment starts to use it.
+func lockObjects(tx *gorm.DB, keys ...string) error {
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claimUpload checks, inside the transaction that saves the attachment,
+// that the objects of a reused upload are still there to share.
+func claimUpload(tx *gorm.DB, stored *storedUpload) error {
+	if !stored.Reused {
+		return nil
+	}
+	if err := lockObjects(tx, stored.Key); err != nil {
+		return err
+	}
+	var refs int64
+	if err := tx.Model(&models.ExpenseAttachment{}).Where("file_path = ?", stored.Key).Count(&refs).Error; err != nil {
+		return err
+	}
+	if refs == 0 {
+		return errUploadReleased
+	}
+	return nil
+}
+
+// releaseObjects returns the stored objects no attachment refers to once tx
+// commits; pass them to deleteObjects after the commit. Objects can be
+// shared between identical attachments.
+func releaseObjects(tx *gorm.DB, keys ...string) ([]string, error) {
+	var unused []string
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := lockObjects(tx, key); err != nil {
+			return nil, err
+		}
+		var refs int64
+		if err := tx.Model(&models.ExpenseAttachment{}).Where("file_path = ? OR thumbnail_path = ?", key, key).Count(&refs).Error; err != nil {
+			return nil, err
+		}
+		if refs == 0 {
+			unused = append(unused, key)
+		}
+	}
+	return unused, nil
+}
+
+func deleteObjects(keys []string) {
+	for _, key := range keys {
+		storage.Files.Delete(context.Background(), key)
+	}
+}
+
+// markReusedReceipts flags attachments whose file is also attached to other
+// expenses in the same group. Receipts are never matched across groups.
+func markReusedReceipts(groupID uint, attachments []models.ExpenseAttachment) {
+	for i := range attachments {
+		a := &attachments[i]
+		if a.SHA256 == "" {
+			continue
+		}
+
+		database.DB.Table("expense_attachments").
+			Distinct("expense_attachments.expense_id").
+			Joins("JOIN expense_requests ON expense_requests.id = expense_attachments.expense_id").
+			Where("expense_attachments.sha256 = ? AND expense_attachments.expense_id <> ?", a.SHA256, a.ExpenseID).
+			Where("expense_requests.group_id = ?", groupID).
+			Order("expense_attachments.expense_id").
+			Pluck("expense_attachments.expense_id", &a.ReusedInExpenseIDs)
+		a.ReusedElsewhere = len(a.ReusedInExpenseIDs) > 0
+	}
+}
+
+func ListAttachments(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var expense models.ExpenseRequest
+	if err := database.DB.First(&expense, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
+	}
+
+	// Verify membership
+	var memberCount int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", expense.GroupID, userID).Count(&memberCount)
+	if memberCount == 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+	if !apiKeyAllowsGroup(c, expense.GroupID) {
+		return apiKeyGroupDenied(c)
+	}
+
+	attachments := make([]models.ExpenseAttachment, 0)
+	if err := database.DB.Preload("Extraction").Where("expense_id = ?", expense.ID).Order("uploaded_at").Find(&attachments).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch attachments"})
+	}
+	markReusedReceipts(expense.GroupID, attachments)
+
+	return c.JSON(attachments)
+}
+
+func DeleteAttachment(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var attachment models.ExpenseAttachment
+	if err := database.DB.First(&attachment, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	if _, err := loadEditableExpense(attachment.ExpenseID, userID); err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	tx := database.DB.Begin()
+
+	if err := tx.Where("attachment_id = ?", attachment.ID).Delete(&models.ReceiptExtraction{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete attachment"})
+	}
+	if err := tx.Delete(&attachment).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete attachment"})
+	}
+	unused, err := releaseObjects(tx, attachment.FilePath, attachment.ThumbnailPath)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete attachment"})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete attachment"})
+	}
+
+	deleteObjects(unused)
+
+	return c.JSON(fiber.Map{"message": "Attachment deleted successfully"})
+}
+
+// ReplaceAttachment swaps the file of an attachment, e.g. for a clearer
+// photo of the same receipt.
+func ReplaceAttachment(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var attachment models.ExpenseAttachment
+	if err := database.DB.First(&attachment, c.Params("id")).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+	expense, err := loadEditableExpense(attachment.ExpenseID, userID)
+	if err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No file uploaded"})
+	}
+
+	stored, err := storeUpload(file, upload.Attachment, "attachments", expense.GroupID)
+	if err != nil {
+		return uploadError(c, err)
+	}
+	if stored.SHA256 == attachment.SHA256 {
+		// Same content, nothing to replace
+		return c.JSON(attachment)
+	}
+	if duplicate := findDuplicateAttachment(expense.ID, stored.SHA256, attachment.ID); duplicate != nil {
+		deleteUpload(stored)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This file is already attached to the expense", "attachment": duplicate})
+	}
+
+	oldKeys := []string{attachment.FilePath, attachment.ThumbnailPath}
+	attachment.FileName = stored.Name
+	attachment.FilePath = stored.Key
+	attachment.ThumbnailPath = stored.Variants["thumb"]
+	attachment.FileSize = stored.Size
+	attachment.FileType = stored.ContentType
+	attachment.SHA256 = stored.SHA256
+	attachment.UploadedBy = userID
+	attachment.UploadedAt = time.Now()
+
+	tx := database.DB.Begin()
+
+	if err := claimUpload(tx, stored); err != nil {
+		tx.Rollback()
+		return uploadError(c, err)
+	}
+	if err := tx.Save(&attachment).Error; err != nil {
+		tx.Rollback()
+		deleteUpload(stored)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update attachment"})
+	}
+	unused, err := releaseObjects(tx, oldKeys...)
+	if err != nil {
+		tx.Rollback()
+		deleteUpload(stored)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update attachment"})
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		deleteUpload(stored)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update attachment"})
+	}
+	deleteObjects(unused)
+
+	attachment.Extraction = queueReceipt(&attachment)
+	attachments := []models.ExpenseAttachment{attachment}
+	markReusedReceipts(expense.GroupID, attachments)
+
+	return c.JSON(attachments[0])
+}
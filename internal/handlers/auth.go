@@ -1,29 +1,38 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"log"
+	"strings"
 	"time"
 
 	"spendwise-backend/internal/database"
 	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/ratelimit"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/storage"
+	"spendwise-backend/internal/validation"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func Signup(c *fiber.Ctx) error {
-	type SignupRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
-		FullName string `json:"full_name"`
-	}
+type signupRequest struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,password"`
+	FullName string `json:"full_name" validate:"required,max=100"`
+}
 
-	var req SignupRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+func (r *signupRequest) Normalize() {
+	r.Email = strings.TrimSpace(r.Email)
+	r.FullName = strings.TrimSpace(r.FullName)
+}
+
+func Signup(c *fiber.Ctx) error {
+	var req signupRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -41,44 +50,68 @@ func Signup(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not create user. Email might be taken."})
 	}
 
+	// The account works right away; sensitive actions wait for verification
+	if err := sendVerificationEmail(&user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	return c.JSON(user)
 }
 
 func Login(c *fiber.Ctx) error {
 	type LoginRequest struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email      string `json:"email" validate:"required,max=255"`
+		Password   string `json:"password" validate:"required,max=200"`
+		DeviceName string `json:"device_name" validate:"max=100"` // Optional; derived from the user agent otherwise
 	}
 
 	var req LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	lockout := ratelimit.DefaultLockout()
+	if wait, _ := lockout.Locked(c.Context(), req.Email); wait > 0 {
+		return tooManyAttempts(c, wait)
 	}
 
 	var user models.User
 	if result := database.DB.Where("email = ?", req.Email).First(&user); result.Error != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return failedLogin(c, lockout, req.Email, "Invalid credentials")
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return failedLogin(c, lockout, req.Email, "Invalid credentials")
 	}
 
-	// Generate JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"exp":     time.Now().Add(time.Hour * 72).Unix(),
-	})
+	// With 2FA on, the password only earns a challenge for LoginTwoFactor
+	if user.TOTPEnabledAt != nil {
+		challenge, err := signChallengeToken(&user, req.DeviceName)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
+		}
+		return c.JSON(fiber.Map{
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+		})
+	}
 
-	t, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
+	lockout.Succeed(c.Context(), req.Email)
+	return login(c, &user, req.DeviceName)
+}
+
+// failedLogin counts a failed attempt against the account, which locks it
+// for longer and longer after repeated failures.
+func failedLogin(c *fiber.Ctx, lockout *ratelimit.Lockout, account, message string) error {
+	if wait, err := lockout.Fail(c.Context(), account); err == nil && wait > 0 {
+		return tooManyAttempts(c, wait)
 	}
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": message})
+}
 
-	return c.JSON(fiber.Map{
-		"token": t,
-		"user":  user,
-	})
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, ratelimit.RetryAfter(wait))
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many failed attempts, please try again later"})
 }
 
 func GetMe(c *fiber.Ctx) error {
@@ -92,17 +125,27 @@ func GetMe(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
-func UpdateProfile(c *fiber.Ctx) error {
-	userID := c.Locals("user_id").(uint)
+// updateProfileRequest leaves out fields that are not sent.
+type updateProfileRequest struct {
+	FullName *string `json:"full_name" validate:"notblank,max=100"`
+	Phone    *string `json:"phone" validate:"phone"` // Empty clears it
+}
 
-	type UpdateProfileRequest struct {
-		FullName string `json:"full_name"`
-		Phone    string `json:"phone"`
+func (r *updateProfileRequest) Normalize() {
+	if r.FullName != nil {
+		*r.FullName = strings.TrimSpace(*r.FullName)
 	}
+	if r.Phone != nil {
+		*r.Phone = validation.NormalizePhone(*r.Phone)
+	}
+}
+
+func UpdateProfile(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
 
-	var req UpdateProfileRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	var req updateProfileRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	var user models.User
@@ -110,11 +153,22 @@ func UpdateProfile(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
-	user.FullName = req.FullName
-	user.Phone = req.Phone
+	// Only the sent columns are written, so a concurrent password reset or
+	// token version bump on the same row is not undone
+	updates := map[string]interface{}{}
+	if req.FullName != nil {
+		user.FullName = *req.FullName
+		updates["full_name"] = user.FullName
+	}
+	if req.Phone != nil {
+		user.Phone = *req.Phone
+		updates["phone"] = user.Phone
+	}
 
-	if err := database.DB.Save(&user).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update profile"})
+	if len(updates) > 0 {
+		if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update profile"})
+		}
 	}
 
 	return c.JSON(user)
@@ -124,13 +178,13 @@ func ChangePassword(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
 	type ChangePasswordRequest struct {
-		CurrentPassword string `json:"currentPassword"` // Match frontend key
-		NewPassword     string `json:"newPassword"`
+		CurrentPassword string `json:"currentPassword" validate:"required"` // Match frontend key
+		NewPassword     string `json:"newPassword" validate:"required,password"`
 	}
 
 	var req ChangePasswordRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	var user models.User
@@ -138,14 +192,8 @@ func ChangePassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
-	// Verify current password (optional but recommended for security)
-	// Note: Frontend might not send current password if it's a simple reset flow,
-	// but for "Change Password" it usually does.
-	// If the frontend sends it, we should check it.
-	if req.CurrentPassword != "" {
-		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid current password"})
-		}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid current password"})
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
@@ -153,13 +201,33 @@ func ChangePassword(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not hash password"})
 	}
 
-	user.PasswordHash = string(hash)
+	tx := database.DB.Begin()
+
+	if err := tx.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update password"})
+	}
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	// Log out every session, then give this one fresh tokens
+	if err := invalidateUserTokens(tx, &user); err != nil {
+		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update password"})
 	}
+	session, err := startSession(tx, c, &user, "")
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start session"})
+	}
+	tokens, err := issueTokens(tx, &user, session)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
+	}
+
+	tx.Commit()
 
-	return c.JSON(fiber.Map{"message": "Password updated successfully"})
+	tokens["message"] = "Password updated successfully"
+	return c.JSON(tokens)
 }
 
 func UploadAvatar(c *fiber.Ctx) error {
@@ -170,30 +238,35 @@ func UploadAvatar(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No file uploaded"})
 	}
 
-	uploadDir := "./uploads/avatars"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.MkdirAll(uploadDir, 0755)
-	}
-
-	filename := fmt.Sprintf("%d_%d_%s", userID, time.Now().Unix(), file.Filename)
-	filepath := filepath.Join(uploadDir, filename)
-
-	if err := c.SaveFile(file, filepath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save file"})
-	}
-
 	var user models.User
-	if result := database.DB.First(&user, userID); result.Error != nil {
+	if result := database.DB.Select("id", "avatar_url").First(&user, userID); result.Error != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
 	}
 
-	// Construct public URL (assuming static file serving is set up)
-	// Note: In production, this should be a full URL or relative path handled by frontend
-	user.AvatarURL = "/uploads/avatars/" + filename
+	stored, err := storeUpload(file, upload.Avatar, "avatars", 0)
+	if err != nil {
+		return uploadError(c, err)
+	}
 
-	if err := database.DB.Save(&user).Error; err != nil {
+	oldURL := user.AvatarURL
+	user.AvatarURL = models.UploadURL(stored.Key)
+
+	// Processing the image takes a while; write only the avatar so the rest
+	// of the row is not overwritten with what was read before
+	if err := database.DB.Model(&user).Update("avatar_url", user.AvatarURL).Error; err != nil {
+		deleteUpload(stored)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update avatar URL"})
 	}
 
-	return c.JSON(fiber.Map{"avatar_url": user.AvatarURL})
+	// The previous avatar is no longer referenced
+	if oldKey, ok := models.UploadKey(oldURL); ok {
+		for _, key := range upload.AvatarKeys(oldKey) {
+			storage.Files.Delete(context.Background(), key)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"avatar_url":       user.AvatarURL,
+		"avatar_small_url": models.UploadURL(stored.Variants[fmt.Sprint(upload.AvatarSizes[len(upload.AvatarSizes)-1])]),
+	})
 }
@@ -1,11 +1,25 @@
 package handlers
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/middleware"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/mail"
+	"spendwise-backend/internal/services/oidc"
+	"spendwise-backend/internal/services/totp"
+
+	"github.com/gofiber/fiber/v2"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,6 +64,28 @@ func TestSignup(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, 400, resp.StatusCode)
 	})
+
+	t.Run("Invalid Fields", func(t *testing.T) {
+		payload := map[string]string{
+			"email":    "not-an-email",
+			"password": "short",
+		}
+		body, _ := json.Marshal(payload)
+		req := httptest.NewRequest("POST", "/auth/signup", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 400, resp.StatusCode)
+
+		var result struct {
+			Fields map[string]string `json:"fields"`
+		}
+		json.NewDecoder(resp.Body).Decode(&result)
+		assert.Contains(t, result.Fields, "email")
+		assert.Contains(t, result.Fields, "password")
+		assert.Equal(t, "is required", result.Fields["full_name"])
+	})
 }
 
 func TestLogin(t *testing.T) {
@@ -64,8 +100,7 @@ func TestLogin(t *testing.T) {
 		"password":  "password123",
 		"full_name": "Login User",
 	}
-	signupBody, _ := json.Marshal(signupPayload)
-	app.Test(httptest.NewRequest("POST", "/auth/signup", bytes.NewReader(signupBody)))
+	sendWithToken(t, app, "POST", "/auth/signup", "", signupPayload)
 
 	t.Run("Success", func(t *testing.T) {
 		payload := map[string]string{
@@ -97,3 +132,441 @@ func TestLogin(t *testing.T) {
 		assert.Equal(t, 401, resp.StatusCode)
 	})
 }
+
+func TestRefreshToken(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/login", Login)
+	app.Post("/auth/refresh", RefreshToken)
+
+	login := signupAndLogin(t, app, "refresh@example.com", "password123", "Refresh User")
+	first, _ := login["refresh_token"].(string)
+	assert.NotEmpty(t, first)
+
+	t.Run("Rotates", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/refresh", "", map[string]string{"refresh_token": first})
+		assert.Equal(t, 200, status)
+	})
+
+	t.Run("Reuse Is Rejected", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/refresh", "", map[string]string{"refresh_token": first})
+		assert.Equal(t, 401, status)
+	})
+
+	t.Run("Unknown Token", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/refresh", "", map[string]string{"refresh_token": "not-a-token"})
+		assert.Equal(t, 401, status)
+	})
+}
+
+func TestDescribeDevice(t *testing.T) {
+	assert.Equal(t, "Chrome on Windows", describeDevice("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"))
+	assert.Equal(t, "Safari on iPhone", describeDevice("Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"))
+	assert.Equal(t, "Edge on Windows", describeDevice("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0"))
+	assert.Equal(t, "Unknown device", describeDevice(""))
+}
+
+func TestPasswordReset(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	outbox := mail.Outbox.(*mail.Memory)
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/login", Login)
+	app.Post("/auth/forgot-password", ForgotPassword)
+	app.Post("/auth/reset-password", ResetPassword)
+
+	sendWithToken(t, app, "POST", "/auth/signup", "", map[string]string{"email": "reset@example.com", "password": "password123", "full_name": "Reset User"})
+
+	var user models.User
+	database.DB.Where("email = ?", "reset@example.com").First(&user)
+	key := models.APIKey{UserID: user.ID, Name: "script", Prefix: models.APIKeyPrefix + "reset", KeyHash: hashToken("reset-key"), Scopes: []string{models.ScopeExpensesRead}}
+	database.DB.Create(&key)
+
+	t.Run("Unknown Email Looks The Same", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/forgot-password", "", map[string]string{"email": "nobody@example.com"})
+		assert.Equal(t, 200, status)
+	})
+
+	status, _ := sendWithToken(t, app, "POST", "/auth/forgot-password", "", map[string]string{"email": "reset@example.com"})
+	assert.Equal(t, 200, status)
+
+	// Mail is sent in the background
+	var msg mail.Message
+	assert.Eventually(t, func() bool {
+		for _, m := range outbox.Messages() {
+			if strings.HasPrefix(m.Subject, "Reset") {
+				msg = m
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "reset@example.com", msg.To)
+
+	match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(msg.Text)
+	if !assert.Len(t, match, 2) {
+		return
+	}
+	token := match[1]
+
+	t.Run("Success", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/reset-password", "", map[string]string{"token": token, "new_password": "newpassword456"})
+		assert.Equal(t, 200, status)
+		status, _ = sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": "reset@example.com", "password": "newpassword456"})
+		assert.Equal(t, 200, status)
+		status, _ = sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": "reset@example.com", "password": "password123"})
+		assert.Equal(t, 401, status)
+
+		// Keys made before the reset may belong to whoever knew the old password
+		database.DB.First(&key, key.ID)
+		assert.NotNil(t, key.RevokedAt)
+	})
+
+	t.Run("Token Is Single Use", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/reset-password", "", map[string]string{"token": token, "new_password": "another789"})
+		assert.Equal(t, 400, status)
+	})
+}
+
+func TestEmailVerification(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	outbox := mail.Outbox.(*mail.Memory)
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/verify-email", VerifyEmail)
+
+	t.Run("Invalid Email", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/signup", "", map[string]string{"email": "not-an-email", "password": "password123", "full_name": "Nobody"})
+		assert.Equal(t, 400, status)
+	})
+
+	status, _ := sendWithToken(t, app, "POST", "/auth/signup", "", map[string]string{"email": "verify@example.com", "password": "password123", "full_name": "Verify User"})
+	assert.Equal(t, 200, status)
+
+	var msg mail.Message
+	assert.Eventually(t, func() bool {
+		for _, m := range outbox.Messages() {
+			if m.To == "verify@example.com" {
+				msg = m
+				return true
+			}
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	match := regexp.MustCompile(`token=([A-Za-z0-9_-]+)`).FindStringSubmatch(msg.Text)
+	if !assert.Len(t, match, 2) {
+		return
+	}
+
+	status, _ = sendWithToken(t, app, "POST", "/auth/verify-email", "", map[string]string{"token": match[1]})
+	assert.Equal(t, 200, status)
+	status, _ = sendWithToken(t, app, "POST", "/auth/verify-email", "", map[string]string{"token": match[1]})
+	assert.Equal(t, 400, status)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/login", Login)
+	app.Post("/auth/login/2fa", LoginTwoFactor)
+
+	sendWithToken(t, app, "POST", "/auth/signup", "", map[string]string{"email": "2fa@example.com", "password": "password123", "full_name": "Two Factor"})
+
+	secret := totp.GenerateSecret()
+	sealed, _ := totp.Seal(secret)
+	now := time.Now()
+	database.DB.Model(&models.User{}).Where("email = ?", "2fa@example.com").
+		Updates(map[string]interface{}{"totp_secret": sealed, "totp_enabled_at": now})
+
+	status, body := sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": "2fa@example.com", "password": "password123"})
+	assert.Equal(t, 200, status)
+	var result map[string]interface{}
+	json.Unmarshal(body, &result)
+	assert.Equal(t, true, result["two_factor_required"])
+	assert.Nil(t, result["token"])
+	challenge, _ := result["challenge_token"].(string)
+
+	t.Run("Wrong Code", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/login/2fa", "", map[string]string{"challenge_token": challenge, "code": "000000"})
+		assert.Equal(t, 401, status)
+	})
+
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+
+	t.Run("Success", func(t *testing.T) {
+		status, body := sendWithToken(t, app, "POST", "/auth/login/2fa", "", map[string]string{"challenge_token": challenge, "code": code})
+		assert.Equal(t, 200, status)
+		var result map[string]interface{}
+		json.Unmarshal(body, &result)
+		assert.NotEmpty(t, result["token"])
+	})
+
+	t.Run("Code Cannot Be Replayed", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/login/2fa", "", map[string]string{"challenge_token": challenge, "code": code})
+		assert.Equal(t, 401, status)
+	})
+}
+
+func TestConfirmTwoFactorEndsOtherSessions(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+
+	user := createTestUser("enrol@example.com", false)
+	secret := totp.GenerateSecret()
+	sealed, _ := totp.Seal(secret)
+	database.DB.Model(&user).Update("totp_secret", sealed)
+
+	current := models.Session{UserID: user.ID, LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	other := models.Session{UserID: user.ID, LastSeenAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	database.DB.Create(&current)
+	database.DB.Create(&other)
+
+	app.Post("/auth/2fa/confirm", asTestUser, func(c *fiber.Ctx) error {
+		c.Locals("session_id", current.ID)
+		return c.Next()
+	}, ConfirmTwoFactor)
+
+	code, _ := totp.Code(secret, totp.Step(time.Now()))
+	status, body := sendAs(t, app, "POST", "/auth/2fa/confirm", user.ID, strings.NewReader(fmt.Sprintf(`{"code": %q}`, code)))
+	assert.Equal(t, 200, status, string(body))
+
+	// A session from before enrolment never showed a second factor
+	database.DB.First(&other, other.ID)
+	assert.NotNil(t, other.RevokedAt)
+	database.DB.First(&current, current.ID)
+	assert.Nil(t, current.RevokedAt)
+}
+
+func TestSafeRedirectPath(t *testing.T) {
+	assert.Equal(t, "/expenses/4", safeRedirectPath("/expenses/4"))
+	assert.Equal(t, "/", safeRedirectPath("https://evil.test"))
+	assert.Equal(t, "/", safeRedirectPath("//evil.test"))
+	assert.Equal(t, "/", safeRedirectPath("/\\evil.test"))
+	assert.Equal(t, "/", safeRedirectPath(""))
+}
+
+func TestAPIKeys(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/login", Login)
+	app.Post("/auth/api-keys", middleware.Protected(), CreateAPIKey)
+	app.Delete("/auth/api-keys/:id", middleware.Protected(), RevokeAPIKey)
+	whoami := func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"user_id": c.Locals("user_id")}) }
+	app.Get("/expenses", middleware.Protected(middleware.APIKeyScopes{
+		fiber.MethodGet:  models.ScopeExpensesRead,
+		fiber.MethodPost: models.ScopeExpensesWrite,
+	}), whoami)
+	app.Post("/expenses", middleware.Protected(middleware.APIKeyScopes{
+		fiber.MethodGet:  models.ScopeExpensesRead,
+		fiber.MethodPost: models.ScopeExpensesWrite,
+	}), whoami)
+
+	login := signupAndLogin(t, app, "keys@example.com", "password123", "Key User")
+	token, _ := login["token"].(string)
+
+	t.Run("Unknown Scope", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/api-keys", token, map[string]interface{}{"name": "Bad", "scopes": []string{"everything"}})
+		assert.Equal(t, 400, status)
+	})
+
+	status, body := sendWithToken(t, app, "POST", "/auth/api-keys", token, map[string]interface{}{"name": "Finance script", "scopes": []string{models.ScopeExpensesRead}})
+	assert.Equal(t, 200, status)
+	var created map[string]interface{}
+	json.Unmarshal(body, &created)
+	key, _ := created["key"].(string)
+	assert.True(t, strings.HasPrefix(key, models.APIKeyPrefix))
+
+	var stored models.APIKey
+	database.DB.Where("name = ?", "Finance script").First(&stored)
+	assert.NotEqual(t, key, stored.KeyHash)
+
+	t.Run("Scoped Route", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "GET", "/expenses", key, nil)
+		assert.Equal(t, 200, status)
+	})
+
+	t.Run("Missing Scope", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/expenses", key, nil)
+		assert.Equal(t, 403, status)
+	})
+
+	t.Run("Login Only Route", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/api-keys", key, map[string]interface{}{"name": "Escalate", "scopes": []string{models.ScopeApprovals}})
+		assert.Equal(t, 403, status)
+	})
+
+	t.Run("No Approvals In Two Factor Groups", func(t *testing.T) {
+		app.Post("/approvals/:id/approve", middleware.Protected(middleware.APIKeyScopes{
+			fiber.MethodPost: models.ScopeApprovals,
+		}), ApproveExpense)
+
+		// The owner has 2FA, but the key never proves it
+		now := time.Now()
+		database.DB.Model(&models.User{}).Where("id = ?", stored.UserID).Update("totp_enabled_at", now)
+		group := models.ExpenseGroup{Name: "Strict", InviteCode: "strict-keys", CreatedBy: stored.UserID, RequireTwoFactor: true}
+		database.DB.Create(&group)
+		database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: stored.UserID, JoinedAt: now})
+		database.DB.Create(&models.UserRole{GroupID: group.ID, UserID: stored.UserID, Role: "approver"})
+		expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: stored.UserID, Title: "Taxi", Category: "Travel", Amount: 10, Status: "pending"}
+		database.DB.Create(&expense)
+
+		approvalKey := models.APIKeyPrefix + "approvals-only"
+		database.DB.Create(&models.APIKey{
+			UserID:  stored.UserID,
+			Name:    "Approver bot",
+			Prefix:  approvalKey[:10],
+			KeyHash: models.HashAPIKey(approvalKey),
+			Scopes:  []string{models.ScopeApprovals},
+		})
+
+		status, body := sendWithToken(t, app, "POST", fmt.Sprintf("/approvals/%d/approve", expense.ID), approvalKey, nil)
+		assert.Equal(t, 403, status)
+		assert.Contains(t, string(body), "two_factor_required")
+
+		database.DB.First(&expense, expense.ID)
+		assert.Equal(t, "pending", expense.Status)
+	})
+
+	t.Run("Revoked", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "DELETE", fmt.Sprintf("/auth/api-keys/%d", stored.ID), token, nil)
+		assert.Equal(t, 200, status)
+		status, _ = sendWithToken(t, app, "GET", "/expenses", key, nil)
+		assert.Equal(t, 401, status)
+	})
+}
+
+func TestAccountExportAndDeletion(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/login", Login)
+	app.Get("/auth/me", middleware.Protected(), GetMe)
+	app.Delete("/auth/me", middleware.Protected(), DeleteAccount)
+	app.Get("/auth/export", middleware.Protected(), ExportAccount)
+
+	login := signupAndLogin(t, app, "leaving@example.com", "password123", "Leaving User")
+	token, _ := login["token"].(string)
+
+	t.Run("Export", func(t *testing.T) {
+		status, data := sendWithToken(t, app, "GET", "/auth/export", token, nil)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "application/zip", http.DetectContentType(data))
+
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if !assert.NoError(t, err) {
+			return
+		}
+		names := make([]string, 0, len(archive.File))
+		for _, f := range archive.File {
+			names = append(names, f.Name)
+		}
+		assert.Contains(t, names, "profile.json")
+		assert.Contains(t, names, "wallet_transactions.json")
+	})
+
+	t.Run("Wrong Password", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "DELETE", "/auth/me", token, map[string]string{"password": "wrongpassword"})
+		assert.Equal(t, 401, status)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "DELETE", "/auth/me", token, map[string]string{"password": "password123"})
+		assert.Equal(t, 200, status)
+
+		var user models.User
+		database.DB.Where("full_name = ?", "Deleted user").First(&user)
+		assert.NotNil(t, user.AnonymizedAt)
+		assert.True(t, strings.HasSuffix(user.Email, "@deleted.invalid"))
+
+		status, _ = sendWithToken(t, app, "GET", "/auth/me", token, nil)
+		assert.Equal(t, 401, status)
+		status, _ = sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": "leaving@example.com", "password": "password123"})
+		assert.Equal(t, 401, status)
+	})
+}
+
+func TestOIDCTakesOverUnverifiedAccount(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/auth/signup", Signup)
+	app.Post("/auth/login", Login)
+	app.Get("/auth/me", middleware.Protected(), GetMe)
+
+	// Someone registers first with the owner's address and never verifies it
+	login := signupAndLogin(t, app, "owner@example.com", "password123", "Squatter")
+	squatterToken, _ := login["token"].(string)
+
+	user, err := userForIdentity("test", &oidc.Claims{Subject: "owner-sub", Email: "Owner@example.com", EmailVerified: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotNil(t, user.VerifiedAt)
+	assert.Empty(t, user.PasswordHash)
+
+	t.Run("Password No Longer Works", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": "owner@example.com", "password": "password123"})
+		assert.Equal(t, 401, status)
+	})
+
+	t.Run("Sessions Are Revoked", func(t *testing.T) {
+		status, _ := sendWithToken(t, app, "GET", "/auth/me", squatterToken, nil)
+		assert.Equal(t, 401, status)
+	})
+
+	t.Run("Verified Account Keeps Its Password", func(t *testing.T) {
+		sendWithToken(t, app, "POST", "/auth/signup", "", map[string]string{"email": "verified@example.com", "password": "password123", "full_name": "Verified"})
+		database.DB.Model(&models.User{}).Where("email = ?", "verified@example.com").Update("verified_at", time.Now())
+
+		_, err := userForIdentity("test", &oidc.Claims{Subject: "verified-sub", Email: "verified@example.com", EmailVerified: true})
+		assert.NoError(t, err)
+		status, _ := sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": "verified@example.com", "password": "password123"})
+		assert.Equal(t, 200, status)
+	})
+}
+
+func TestOIDCCallbackChecksStateCookie(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Get("/auth/oidc/:provider/callback", OIDCCallback)
+
+	identityProviders()
+	ssoProviders = map[string]*oidc.Provider{"test": {Name: "test"}}
+	defer func() { ssoProviders = map[string]*oidc.Provider{} }()
+
+	state := "attacker-state"
+	database.DB.Create(&models.OIDCLoginState{
+		StateHash: hashToken(state),
+		Provider:  "test",
+		ExpiresAt: time.Now().Add(time.Minute),
+	})
+
+	callback := func(cookie string) string {
+		req := httptest.NewRequest("GET", "/auth/oidc/test/callback?state="+state+"&code=abc", nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: oidcStateCookie, Value: cookie})
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, 302, resp.StatusCode)
+		return resp.Header.Get("Location")
+	}
+
+	t.Run("Missing Cookie", func(t *testing.T) {
+		assert.Contains(t, callback(""), "error=invalid_state")
+		var count int64
+		database.DB.Model(&models.OIDCLoginState{}).Where("state_hash = ?", hashToken(state)).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Other Browser", func(t *testing.T) {
+		assert.Contains(t, callback(hashToken("victim-state")), "error=invalid_state")
+	})
+
+	t.Run("Same Browser", func(t *testing.T) {
+		assert.NotContains(t, callback(hashToken(state)), "invalid_state")
+	})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func CreateBudget(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group id"})
+	}
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage budgets"})
+	}
+
+	var budget models.Budget
+	if err := parseBody(c, &budget); err != nil {
+		return badRequest(c, err)
+	}
+	budget.ID = 0
+	budget.GroupID = uint(groupID)
+	budget.CreatedBy = userID
+
+	if err := validateBudget(&budget); err != nil {
+		return badRequest(c, err)
+	}
+
+	if err := database.DB.Create(&budget).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create budget"})
+	}
+
+	return c.JSON(budget)
+}
+
+// validateBudget checks what the validate tags cannot and fills in defaults.
+func validateBudget(b *models.Budget) error {
+	if b.Period == "custom" {
+		switch {
+		case b.StartsAt == nil:
+			return validation.Errors{"starts_at": "is required for custom budgets"}
+		case b.EndsAt == nil:
+			return validation.Errors{"ends_at": "is required for custom budgets"}
+		case !b.EndsAt.After(*b.StartsAt):
+			return validation.Errors{"ends_at": "must be after starts_at"}
+		}
+	}
+	if b.Enforcement == "" {
+		b.Enforcement = "warn"
+	}
+	if b.WarnPercent <= 0 || b.WarnPercent > 100 {
+		b.WarnPercent = 80
+	}
+	return nil
+}
+
+// ListBudgets returns the group's budgets with live consumption for the
+// current period.
+func ListBudgets(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	var budgets []models.Budget
+	if err := database.DB.Where("group_id = ?", groupID).Order("created_at").Find(&budgets).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch budgets"})
+	}
+
+	now := time.Now()
+	result := make([]map[string]interface{}, 0)
+	for i := range budgets {
+		entry := map[string]interface{}{
+			"budget": budgets[i],
+			"usage":  nil,
+		}
+		if status, ok := jobs.BudgetStatus(&budgets[i], now, 0); ok {
+			entry["usage"] = status
+		}
+		result = append(result, entry)
+	}
+
+	return c.JSON(result)
+}
+
+func UpdateBudget(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+	budgetID := c.Params("budgetId")
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage budgets"})
+	}
+
+	var budget models.Budget
+	if err := database.DB.Where("id = ? AND group_id = ?", budgetID, groupID).First(&budget).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Budget not found"})
+	}
+
+	// Keep identity fields, overwrite the rest from the body
+	id, group, createdBy, createdAt := budget.ID, budget.GroupID, budget.CreatedBy, budget.CreatedAt
+	if err := parseBody(c, &budget); err != nil {
+		return badRequest(c, err)
+	}
+	budget.ID, budget.GroupID, budget.CreatedBy, budget.CreatedAt = id, group, createdBy, createdAt
+
+	if err := validateBudget(&budget); err != nil {
+		return badRequest(c, err)
+	}
+
+	if err := database.DB.Save(&budget).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update budget"})
+	}
+
+	return c.JSON(budget)
+}
+
+func DeleteBudget(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+	budgetID := c.Params("budgetId")
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage budgets"})
+	}
+
+	result := database.DB.Where("id = ? AND group_id = ?", budgetID, groupID).Delete(&models.Budget{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete budget"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Budget not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Budget deleted successfully"})
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgets(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/groups/:id/budgets", asTestUser, CreateBudget)
+	app.Get("/groups/:id/budgets", asTestUser, ListBudgets)
+	app.Put("/groups/:id/budgets/:budgetId", asTestUser, UpdateBudget)
+	app.Delete("/groups/:id/budgets/:budgetId", asTestUser, DeleteBudget)
+	app.Post("/expenses", asTestUser, CreateExpense)
+
+	admin := createTestUser("budget-admin@example.com", false)
+	member := createTestUser("budget-member@example.com", false)
+	group := createTestGroup("budgets", false, admin, map[uint]string{
+		admin.ID:  "admin",
+		member.ID: "requester",
+	})
+	path := fmt.Sprintf("/groups/%d/budgets", group.ID)
+
+	// Already spent this month
+	database.DB.Create(&models.ExpenseRequest{GroupID: group.ID, RequesterID: member.ID, Title: "Groceries", Category: "Food", Amount: 70, Status: "approved"})
+
+	var budget models.Budget
+
+	t.Run("Create", func(t *testing.T) {
+		payload := `{"name": "Food", "category": "Food", "period": "monthly", "amount": 100, "enforcement": "block"}`
+		status, _ := sendAs(t, app, "POST", path, member.ID, strings.NewReader(payload))
+		assert.Equal(t, 403, status)
+
+		status, body := sendAs(t, app, "POST", path, admin.ID, strings.NewReader(payload))
+		assert.Equal(t, 200, status)
+		json.Unmarshal(body, &budget)
+		assert.Equal(t, float64(80), budget.WarnPercent)
+
+		status, _ = sendAs(t, app, "POST", path, admin.ID, strings.NewReader(`{"period": "custom", "amount": 100}`))
+		assert.Equal(t, 400, status)
+	})
+
+	t.Run("List Shows Usage", func(t *testing.T) {
+		status, body := sendAs(t, app, "GET", path, member.ID, nil)
+		assert.Equal(t, 200, status)
+
+		var list []struct {
+			Budget models.Budget      `json:"budget"`
+			Usage  models.BudgetAlert `json:"usage"`
+		}
+		json.Unmarshal(body, &list)
+		if assert.Len(t, list, 1) {
+			assert.Equal(t, float64(70), list[0].Usage.Spent)
+			assert.Equal(t, "", list[0].Usage.Level)
+		}
+	})
+
+	t.Run("Blocks Expenses Over The Limit", func(t *testing.T) {
+		status, body := sendAs(t, app, "POST", "/expenses", member.ID,
+			strings.NewReader(fmt.Sprintf(`{"group_id": %d, "title": "Dinner", "category": "Food", "amount": 40}`, group.ID)))
+		assert.Equal(t, 422, status)
+		assert.Contains(t, string(body), "exceeded")
+
+		// Other categories are not counted against it
+		status, _ = sendAs(t, app, "POST", "/expenses", member.ID,
+			strings.NewReader(fmt.Sprintf(`{"group_id": %d, "title": "Taxi", "category": "Travel", "amount": 40}`, group.ID)))
+		assert.Equal(t, 200, status)
+	})
+
+	t.Run("Blocks Recurring Expenses Too", func(t *testing.T) {
+		due := time.Now().Add(-time.Minute)
+		recurring := models.RecurringExpense{
+			GroupID:        group.ID,
+			RequesterID:    member.ID,
+			Title:          "Weekly groceries",
+			Category:       "Food",
+			Amount:         40,
+			IsDirectRecord: true,
+			Frequency:      "weekly",
+			StartsAt:       due.AddDate(0, 0, -7),
+			NextRunAt:      &due,
+			IsActive:       true,
+		}
+		database.DB.Create(&recurring)
+		defer database.DB.Model(&recurring).Update("is_active", false)
+
+		assert.NoError(t, jobs.GenerateRecurringExpenses())
+
+		var generated int64
+		database.DB.Model(&models.ExpenseRequest{}).Where("recurring_id = ?", recurring.ID).Count(&generated)
+		assert.Equal(t, int64(0), generated)
+		var wallet models.User
+		database.DB.First(&wallet, member.ID)
+		assert.Equal(t, float64(0), wallet.WalletBalance)
+
+		// The blocked run is skipped, not retried on every tick
+		database.DB.First(&recurring, recurring.ID)
+		if assert.NotNil(t, recurring.NextRunAt) {
+			assert.True(t, recurring.NextRunAt.After(due))
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		status, body := sendAs(t, app, "PUT", fmt.Sprintf("%s/%d", path, budget.ID), admin.ID,
+			strings.NewReader(`{"name": "Food", "category": "Food", "period": "monthly", "amount": 200, "enforcement": "warn"}`))
+		assert.Equal(t, 200, status)
+		var updated models.Budget
+		json.Unmarshal(body, &updated)
+		assert.Equal(t, budget.ID, updated.ID)
+		assert.Equal(t, group.ID, updated.GroupID)
+		assert.Equal(t, float64(200), updated.Amount)
+
+		status, _ = sendAs(t, app, "POST", "/expenses", member.ID,
+			strings.NewReader(fmt.Sprintf(`{"group_id": %d, "title": "Dinner", "category": "Food", "amount": 40}`, group.ID)))
+		assert.Equal(t, 200, status)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		budgetPath := fmt.Sprintf("%s/%d", path, budget.ID)
+		status, _ := sendAs(t, app, "DELETE", budgetPath, member.ID, nil)
+		assert.Equal(t, 403, status)
+		status, _ = sendAs(t, app, "DELETE", budgetPath, admin.ID, nil)
+		assert.Equal(t, 200, status)
+		status, _ = sendAs(t, app, "DELETE", budgetPath, admin.ID, nil)
+		assert.Equal(t, 404, status)
+	})
+}
@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"strings"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// defaultCategories seeds the catalog of every new group.
+var defaultCategories = []models.Category{
+	{Name: "Food", Icon: "utensils", Color: "#F97316"},
+	{Name: "Travel", Icon: "plane", Color: "#3B82F6"},
+	{Name: "Office", Icon: "briefcase", Color: "#8B5CF6"},
+	{Name: "Utilities", Icon: "bolt", Color: "#EAB308"},
+	{Name: "Other", Icon: "tag", Color: "#6B7280"},
+}
+
+func seedCategories(tx *gorm.DB, groupID uint) error {
+	for _, def := range defaultCategories {
+		category := def
+		category.GroupID = groupID
+		category.IsActive = true
+		if err := tx.Create(&category).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveCategory finds the active catalog entry for an expense, by ID or by
+// case-insensitive name. Groups without a catalog keep accepting free-form
+// names, in which case nil is returned with an empty error message.
+func resolveCategory(groupID uint, categoryID *uint, name string) (*models.Category, string) {
+	var category models.Category
+	if categoryID != nil && *categoryID > 0 {
+		if err := database.DB.Where("id = ? AND group_id = ?", *categoryID, groupID).First(&category).Error; err != nil {
+			return nil, "Unknown category"
+		}
+	} else {
+		var count int64
+		database.DB.Model(&models.Category{}).Where("group_id = ?", groupID).Count(&count)
+		if count == 0 {
+			if strings.TrimSpace(name) == "" {
+				return nil, "Category is required"
+			}
+			return nil, ""
+		}
+		if err := database.DB.Where("group_id = ? AND LOWER(name) = LOWER(?)", groupID, strings.TrimSpace(name)).First(&category).Error; err != nil {
+			return nil, "Unknown category"
+		}
+	}
+
+	if !category.IsActive {
+		return nil, "Category is inactive"
+	}
+	return &category, ""
+}
+
+func ListCategories(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	query := database.DB.Where("group_id = ?", groupID)
+	if c.Query("include_inactive") != "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	categories := make([]models.Category, 0)
+	if err := query.Order("name").Find(&categories).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch categories"})
+	}
+
+	return c.JSON(categories)
+}
+
+func CreateCategory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group id"})
+	}
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage categories"})
+	}
+
+	type CreateCategoryRequest struct {
+		Name     string `json:"name" validate:"required,max=100"`
+		Icon     string `json:"icon" validate:"max=50"`
+		Color    string `json:"color" validate:"max=20"`
+		ParentID *uint  `json:"parent_id"`
+	}
+
+	var req CreateCategoryRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	category := models.Category{
+		GroupID:  uint(groupID),
+		Name:     strings.TrimSpace(req.Name),
+		Icon:     req.Icon,
+		Color:    req.Color,
+		IsActive: true,
+		ParentID: req.ParentID,
+	}
+	if msg := validateCategory(&category); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := database.DB.Create(&category).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create category"})
+	}
+
+	return c.JSON(category)
+}
+
+// validateCategory checks name uniqueness (ignoring case) and that the parent
+// belongs to the same group without forming a cycle.
+func validateCategory(category *models.Category) string {
+	if category.Name == "" {
+		return "Name is required"
+	}
+
+	var duplicates int64
+	database.DB.Model(&models.Category{}).
+		Where("group_id = ? AND LOWER(name) = LOWER(?) AND id <> ?", category.GroupID, category.Name, category.ID).
+		Count(&duplicates)
+	if duplicates > 0 {
+		return "A category with this name already exists"
+	}
+
+	// Walk up the parent chain
+	seen := map[uint]bool{category.ID: true}
+	parentID := category.ParentID
+	for parentID != nil {
+		if seen[*parentID] {
+			return "Parent category would create a cycle"
+		}
+		seen[*parentID] = true
+
+		var parent models.Category
+		if err := database.DB.Where("id = ? AND group_id = ?", *parentID, category.GroupID).First(&parent).Error; err != nil {
+			return "Parent category not found"
+		}
+		parentID = parent.ParentID
+	}
+	return ""
+}
+
+func UpdateCategory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+	categoryID := c.Params("categoryId")
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage categories"})
+	}
+
+	type UpdateCategoryRequest struct {
+		Name     *string `json:"name" validate:"notblank,max=100"`
+		Icon     *string `json:"icon" validate:"max=50"`
+		Color    *string `json:"color" validate:"max=20"`
+		IsActive *bool   `json:"is_active"`
+		ParentID *uint   `json:"parent_id"` // 0 clears the parent
+	}
+
+	var req UpdateCategoryRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var category models.Category
+	if err := database.DB.Where("id = ? AND group_id = ?", categoryID, groupID).First(&category).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	}
+
+	oldName := category.Name
+	if req.Name != nil {
+		category.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Icon != nil {
+		category.Icon = *req.Icon
+	}
+	if req.Color != nil {
+		category.Color = *req.Color
+	}
+	if req.IsActive != nil {
+		category.IsActive = *req.IsActive
+	}
+	if req.ParentID != nil {
+		if *req.ParentID == 0 {
+			category.ParentID = nil
+		} else {
+			category.ParentID = req.ParentID
+		}
+	}
+
+	if msg := validateCategory(&category); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	tx := database.DB.Begin()
+
+	if err := tx.Save(&category).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update category"})
+	}
+
+	// A rename is propagated to the denormalized names
+	if category.Name != oldName {
+		if err := renameCategoryReferences(tx, category.GroupID, category.ID, oldName, category.Name); err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not rename category references"})
+		}
+	}
+
+	tx.Commit()
+
+	return c.JSON(category)
+}
+
+// renameCategoryReferences points expenses, recurring templates and budgets
+// that used oldName (or sourceID) at the category newName / targetID.
+func renameCategoryReferences(tx *gorm.DB, groupID, targetID uint, oldName, newName string, sourceIDs ...uint) error {
+	ids := append([]uint{targetID}, sourceIDs...)
+
+	if err := tx.Model(&models.ExpenseRequest{}).
+		Where("group_id = ? AND (category_id IN ? OR (category_id IS NULL AND LOWER(category) = LOWER(?)))", groupID, ids, oldName).
+		Updates(map[string]interface{}{"category_id": targetID, "category": newName}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.RecurringExpense{}).
+		Where("group_id = ? AND (category_id IN ? OR LOWER(category) = LOWER(?))", groupID, ids, oldName).
+		Updates(map[string]interface{}{"category_id": targetID, "category": newName}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Budget{}).
+		Where("group_id = ? AND LOWER(category) = LOWER(?)", groupID, oldName).
+		Update("category", newName).Error
+}
+
+// MergeCategory moves everything filed under one category into another and
+// removes the source, e.g. to fold "Meals" into "Food".
+func MergeCategory(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+	categoryID := c.Params("categoryId")
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage categories"})
+	}
+
+	type MergeRequest struct {
+		IntoID uint `json:"into_id" validate:"required"`
+	}
+
+	var req MergeRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var source, target models.Category
+	if err := database.DB.Where("id = ? AND group_id = ?", categoryID, groupID).First(&source).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Category not found"})
+	}
+	if err := database.DB.Where("id = ? AND group_id = ?", req.IntoID, groupID).First(&target).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Target category not found"})
+	}
+	if source.ID == target.ID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot merge a category into itself"})
+	}
+
+	tx := database.DB.Begin()
+
+	if err := renameCategoryReferences(tx, source.GroupID, target.ID, source.Name, target.Name, source.ID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not move expenses"})
+	}
+
+	// Children of the source move up to the target (unless that is the target itself)
+	if err := tx.Model(&models.Category{}).
+		Where("parent_id = ? AND id <> ?", source.ID, target.ID).
+		Update("parent_id", target.ID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not move subcategories"})
+	}
+	if target.ParentID != nil && *target.ParentID == source.ID {
+		if err := tx.Model(&target).Update("parent_id", source.ParentID).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not move subcategories"})
+		}
+	}
+
+	if err := tx.Delete(&source).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete merged category"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{"message": "Categories merged successfully", "category": target})
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategories(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/groups/:id/categories", asTestUser, CreateCategory)
+	app.Put("/groups/:id/categories/:categoryId", asTestUser, UpdateCategory)
+	app.Post("/groups/:id/categories/:categoryId/merge", asTestUser, MergeCategory)
+	app.Post("/expenses", asTestUser, CreateExpense)
+
+	admin := createTestUser("categories-admin@example.com", false)
+	member := createTestUser("categories-member@example.com", false)
+	group := createTestGroup("categories", false, admin, map[uint]string{
+		admin.ID:  "admin",
+		member.ID: "requester",
+	})
+	path := fmt.Sprintf("/groups/%d/categories", group.ID)
+	createExpense := func(category string) (int, models.ExpenseRequest) {
+		status, body := sendAs(t, app, "POST", "/expenses", member.ID, strings.NewReader(
+			fmt.Sprintf(`{"group_id": %d, "title": "Lunch", "category": %q, "amount": 12}`, group.ID, category)))
+		var expense models.ExpenseRequest
+		json.Unmarshal(body, &expense)
+		return status, expense
+	}
+	createCategory := func(name string) models.Category {
+		status, body := sendAs(t, app, "POST", path, admin.ID, strings.NewReader(fmt.Sprintf(`{"name": %q}`, name)))
+		assert.Equal(t, 200, status, string(body))
+		var category models.Category
+		json.Unmarshal(body, &category)
+		return category
+	}
+
+	t.Run("Free-Form Without A Catalog", func(t *testing.T) {
+		status, expense := createExpense("Anything")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "Anything", expense.Category)
+		assert.Nil(t, expense.CategoryID)
+
+		status, _ = createExpense(" ")
+		assert.Equal(t, 400, status)
+	})
+
+	var meals, food models.Category
+
+	t.Run("Create", func(t *testing.T) {
+		status, _ := sendAs(t, app, "POST", path, member.ID, strings.NewReader(`{"name": "Meals"}`))
+		assert.Equal(t, 403, status)
+
+		meals = createCategory("Meals")
+		assert.True(t, meals.IsActive)
+		food = createCategory("Food")
+
+		status, _ = sendAs(t, app, "POST", path, admin.ID, strings.NewReader(`{"name": "meals"}`))
+		assert.Equal(t, 400, status)
+	})
+
+	var expense models.ExpenseRequest
+
+	t.Run("Expenses Use The Catalog", func(t *testing.T) {
+		status, _ := createExpense("Anything")
+		assert.Equal(t, 400, status)
+
+		status, expense = createExpense(" meals ")
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "Meals", expense.Category)
+		if assert.NotNil(t, expense.CategoryID) {
+			assert.Equal(t, meals.ID, *expense.CategoryID)
+		}
+	})
+
+	recurring := models.RecurringExpense{GroupID: group.ID, RequesterID: member.ID, Title: "Team lunch", Category: "Meals", CategoryID: &meals.ID, Amount: 40, Frequency: "monthly", DayOfMonth: 1, StartsAt: time.Now(), IsActive: true}
+	database.DB.Create(&recurring)
+	budget := models.Budget{GroupID: group.ID, Name: "Meals", Category: "Meals", Period: "monthly", Amount: 500, CreatedBy: admin.ID}
+	database.DB.Create(&budget)
+
+	t.Run("Rename", func(t *testing.T) {
+		status, _ := sendAs(t, app, "PUT", fmt.Sprintf("%s/%d", path, meals.ID), admin.ID, strings.NewReader(`{"name": "Dining"}`))
+		assert.Equal(t, 200, status)
+
+		database.DB.First(&expense, expense.ID)
+		assert.Equal(t, "Dining", expense.Category)
+		database.DB.First(&recurring, recurring.ID)
+		assert.Equal(t, "Dining", recurring.Category)
+		database.DB.First(&budget, budget.ID)
+		assert.Equal(t, "Dining", budget.Category)
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		mergePath := fmt.Sprintf("%s/%d/merge", path, meals.ID)
+		status, _ := sendAs(t, app, "POST", mergePath, admin.ID, strings.NewReader(fmt.Sprintf(`{"into_id": %d}`, meals.ID)))
+		assert.Equal(t, 400, status)
+
+		status, _ = sendAs(t, app, "POST", mergePath, admin.ID, strings.NewReader(fmt.Sprintf(`{"into_id": %d}`, food.ID)))
+		assert.Equal(t, 200, status)
+
+		database.DB.First(&expense, expense.ID)
+		assert.Equal(t, "Food", expense.Category)
+		if assert.NotNil(t, expense.CategoryID) {
+			assert.Equal(t, food.ID, *expense.CategoryID)
+		}
+		database.DB.First(&recurring, recurring.ID)
+		assert.Equal(t, "Food", recurring.Category)
+		if assert.NotNil(t, recurring.CategoryID) {
+			assert.Equal(t, food.ID, *recurring.CategoryID)
+		}
+		database.DB.First(&budget, budget.ID)
+		assert.Equal(t, "Food", budget.Category)
+
+		var remaining int64
+		database.DB.Model(&models.Category{}).Where("id = ?", meals.ID).Count(&remaining)
+		assert.Equal(t, int64(0), remaining)
+
+		// Free-form expenses from before the catalog are left alone
+		var untouched int64
+		database.DB.Model(&models.ExpenseRequest{}).Where("group_id = ? AND category = ?", group.ID, "Anything").Count(&untouched)
+		assert.Equal(t, int64(1), untouched)
+	})
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var fieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// normalizeTags lowercases, trims and de-duplicates tags.
+func normalizeTags(tags []string) ([]string, string) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > 50 {
+			return nil, "Tags must be at most 50 characters"
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > 20 {
+		return nil, "An expense can have at most 20 tags"
+	}
+	return result, ""
+}
+
+// validateFieldValues checks submitted custom field values against the
+// group's active field definitions and returns them normalized.
+func validateFieldValues(groupID uint, values map[string]interface{}) ([]models.ExpenseFieldValue, string) {
+	var fields []models.CustomField
+	database.DB.Where("group_id = ? AND is_active = ?", groupID, true).Find(&fields)
+
+	byKey := make(map[string]models.CustomField)
+	for _, f := range fields {
+		byKey[f.Key] = f
+	}
+	for key := range values {
+		if _, ok := byKey[key]; !ok {
+			return nil, fmt.Sprintf("Unknown custom field %q", key)
+		}
+	}
+
+	result := make([]models.ExpenseFieldValue, 0)
+	for _, f := range fields {
+		raw, ok := values[f.Key]
+		str := ""
+		if ok && raw != nil {
+			str = strings.TrimSpace(fmt.Sprint(raw))
+		}
+		if str == "" {
+			if f.Required {
+				return nil, fmt.Sprintf("%s is required", f.Label)
+			}
+			continue
+		}
+
+		switch f.Type {
+		case "number":
+			n, err := strconv.ParseFloat(str, 64)
+			if err != nil {
+				return nil, fmt.Sprintf("%s must be a number", f.Label)
+			}
+			str = strconv.FormatFloat(n, 'f', -1, 64)
+		case "date":
+			d, err := time.Parse("2006-01-02", str)
+			if err != nil {
+				return nil, fmt.Sprintf("%s must be a date (YYYY-MM-DD)", f.Label)
+			}
+			str = d.Format("2006-01-02")
+		case "select":
+			valid := false
+			for _, opt := range f.Options {
+				if opt == str {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return nil, fmt.Sprintf("%s must be one of: %s", f.Label, strings.Join(f.Options, ", "))
+			}
+		default:
+			if len(str) > 500 {
+				return nil, fmt.Sprintf("%s must be at most 500 characters", f.Label)
+			}
+		}
+
+		result = append(result, models.ExpenseFieldValue{FieldID: f.ID, Key: f.Key, Value: str})
+	}
+	return result, ""
+}
+
+func saveTagsAndFields(tx *gorm.DB, expenseID uint, tags []string, values []models.ExpenseFieldValue) error {
+	for _, tag := range tags {
+		if err := tx.Create(&models.ExpenseTag{ExpenseID: expenseID, Tag: tag}).Error; err != nil {
+			return err
+		}
+	}
+	for i := range values {
+		values[i].ExpenseID = expenseID
+		if err := tx.Create(&values[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTagFieldFilters narrows an expense query by ?tag=x (repeatable via
+// commas) and ?field.<key>=<value> parameters.
+func applyTagFieldFilters(c *fiber.Ctx, query *gorm.DB) *gorm.DB {
+	if tags := c.Query("tag"); tags != "" {
+		for _, tag := range strings.Split(tags, ",") {
+			tag = strings.ToLower(strings.TrimSpace(tag))
+			if tag == "" {
+				continue
+			}
+			query = query.Where("id IN (SELECT expense_id FROM expense_tags WHERE tag = ?)", tag)
+		}
+	}
+	for param, value := range c.Queries() {
+		key, ok := strings.CutPrefix(param, "field.")
+		if !ok || value == "" {
+			continue
+		}
+		query = query.Where("id IN (SELECT expense_id FROM expense_field_values WHERE key = ? AND value = ?)", key, value)
+	}
+	return query
+}
+
+func ListCustomFields(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	query := database.DB.Where("group_id = ?", groupID)
+	if c.Query("include_inactive") != "true" {
+		query = query.Where("is_active = ?", true)
+	}
+
+	fields := make([]models.CustomField, 0)
+	if err := query.Order("id").Find(&fields).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch custom fields"})
+	}
+
+	return c.JSON(fields)
+}
+
+func validateCustomField(f *models.CustomField) string {
+	if strings.TrimSpace(f.Label) == "" {
+		return "Label is required"
+	}
+	switch f.Type {
+	case "text", "number", "date":
+		f.Options = nil
+	case "select":
+		if len(f.Options) == 0 {
+			return "Select fields need at least one option"
+		}
+	default:
+		return "Type must be text, number, date or select"
+	}
+	return ""
+}
+
+func CreateCustomField(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group id"})
+	}
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage custom fields"})
+	}
+
+	type CreateFieldRequest struct {
+		Key      string   `json:"key" validate:"required"`
+		Label    string   `json:"label" validate:"required,max=100"`
+		Type     string   `json:"type" validate:"required,oneof=text number date select"`
+		Options  []string `json:"options" validate:"max=100"`
+		Required bool     `json:"required"`
+	}
+
+	var req CreateFieldRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	if !fieldKeyPattern.MatchString(req.Key) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Key must be lowercase letters, digits and underscores"})
+	}
+
+	field := models.CustomField{
+		GroupID:  uint(groupID),
+		Key:      req.Key,
+		Label:    req.Label,
+		Type:     req.Type,
+		Options:  req.Options,
+		Required: req.Required,
+		IsActive: true,
+	}
+	if msg := validateCustomField(&field); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := database.DB.Create(&field).Error; err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Could not create custom field. Key might be taken."})
+	}
+
+	return c.JSON(field)
+}
+
+func UpdateCustomField(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+	fieldID := c.Params("fieldId")
+
+	// Verify Admin Permission
+	var role models.UserRole
+	if err := database.DB.Where("group_id = ? AND user_id = ? AND role = 'admin'", groupID, userID).First(&role).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Only admins can manage custom fields"})
+	}
+
+	// Key and type are fixed once values exist
+	type UpdateFieldRequest struct {
+		Label    *string   `json:"label" validate:"notblank,max=100"`
+		Options  *[]string `json:"options" validate:"max=100"`
+		Required *bool     `json:"required"`
+		IsActive *bool     `json:"is_active"`
+	}
+
+	var req UpdateFieldRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var field models.CustomField
+	if err := database.DB.Where("id = ? AND group_id = ?", fieldID, groupID).First(&field).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Custom field not found"})
+	}
+
+	if req.Label != nil {
+		field.Label = *req.Label
+	}
+	if req.Options != nil {
+		field.Options = *req.Options
+	}
+	if req.Required != nil {
+		field.Required = *req.Required
+	}
+	if req.IsActive != nil {
+		field.IsActive = *req.IsActive
+	}
+	if msg := validateCustomField(&field); msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	if err := database.DB.Save(&field).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update custom field"})
+	}
+
+	return c.JSON(field)
+}
+
+// ListGroupTags returns the tags used in a group with usage counts, for
+// autocompletion.
+func ListGroupTags(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	type TagCount struct {
+		Tag   string `json:"tag"`
+		Count int64  `json:"count"`
+	}
+
+	tags := make([]TagCount, 0)
+	if err := database.DB.Table("expense_tags").
+		Select("expense_tags.tag, COUNT(*) AS count").
+		Joins("JOIN expense_requests ON expense_requests.id = expense_tags.expense_id").
+		Where("expense_requests.group_id = ?", groupID).
+		Group("expense_tags.tag").
+		Order("count desc").
+		Scan(&tags).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch tags"})
+	}
+
+	return c.JSON(tags)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"spendwise-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomFieldsAndTags(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Get("/groups/:id/fields", asTestUser, ListCustomFields)
+	app.Post("/groups/:id/fields", asTestUser, CreateCustomField)
+	app.Put("/groups/:id/fields/:fieldId", asTestUser, UpdateCustomField)
+	app.Get("/groups/:id/tags", asTestUser, ListGroupTags)
+	app.Post("/expenses", asTestUser, CreateExpense)
+
+	admin := createTestUser("fields-admin@example.com", false)
+	member := createTestUser("fields-member@example.com", false)
+	group := createTestGroup("fields", false, admin, map[uint]string{
+		admin.ID:  "admin",
+		member.ID: "requester",
+	})
+	fieldsPath := fmt.Sprintf("/groups/%d/fields", group.ID)
+	createExpense := func(extra string) (int, []byte) {
+		return sendAs(t, app, "POST", "/expenses", member.ID, strings.NewReader(
+			fmt.Sprintf(`{"group_id": %d, "title": "Client visit", "category": "Travel", "amount": 30%s}`, group.ID, extra)))
+	}
+
+	var field models.CustomField
+
+	t.Run("Create Field", func(t *testing.T) {
+		payload := `{"key": "project_code", "label": "Project", "type": "select", "options": ["apollo", "gemini"], "required": true}`
+		status, _ := sendAs(t, app, "POST", fieldsPath, member.ID, strings.NewReader(payload))
+		assert.Equal(t, 403, status)
+
+		status, body := sendAs(t, app, "POST", fieldsPath, admin.ID, strings.NewReader(payload))
+		assert.Equal(t, 200, status)
+		json.Unmarshal(body, &field)
+		assert.True(t, field.IsActive)
+
+		status, _ = sendAs(t, app, "POST", fieldsPath, admin.ID, strings.NewReader(`{"key": "Project Code", "label": "Project", "type": "text"}`))
+		assert.Equal(t, 400, status)
+		status, _ = sendAs(t, app, "POST", fieldsPath, admin.ID, strings.NewReader(`{"key": "cost_center", "label": "Cost center", "type": "select"}`))
+		assert.Equal(t, 400, status)
+	})
+
+	t.Run("Expenses Are Checked Against Fields", func(t *testing.T) {
+		status, body := createExpense("")
+		assert.Equal(t, 400, status)
+		assert.Contains(t, string(body), "Project is required")
+
+		status, _ = createExpense(`, "custom_fields": {"project_code": "mercury"}`)
+		assert.Equal(t, 400, status)
+		status, _ = createExpense(`, "custom_fields": {"project_code": "apollo", "unknown": "x"}`)
+		assert.Equal(t, 400, status)
+
+		status, body = createExpense(`, "custom_fields": {"project_code": "apollo"}, "tags": ["Travel", " travel ", "Q3"]`)
+		assert.Equal(t, 200, status)
+		var expense models.ExpenseRequest
+		json.Unmarshal(body, &expense)
+		tags := make([]string, 0, len(expense.Tags))
+		for _, tag := range expense.Tags {
+			tags = append(tags, tag.Tag)
+		}
+		assert.ElementsMatch(t, []string{"travel", "q3"}, tags)
+		if assert.Len(t, expense.FieldValues, 1) {
+			assert.Equal(t, "apollo", expense.FieldValues[0].Value)
+		}
+	})
+
+	t.Run("List Tags", func(t *testing.T) {
+		createExpense(`, "custom_fields": {"project_code": "gemini"}, "tags": ["travel"]`)
+
+		status, body := sendAs(t, app, "GET", fmt.Sprintf("/groups/%d/tags", group.ID), member.ID, nil)
+		assert.Equal(t, 200, status)
+		var tags []struct {
+			Tag   string `json:"tag"`
+			Count int64  `json:"count"`
+		}
+		json.Unmarshal(body, &tags)
+		if assert.Len(t, tags, 2) {
+			assert.Equal(t, "travel", tags[0].Tag)
+			assert.Equal(t, int64(2), tags[0].Count)
+		}
+	})
+
+	t.Run("Deactivate Field", func(t *testing.T) {
+		status, _ := sendAs(t, app, "PUT", fmt.Sprintf("%s/%d", fieldsPath, field.ID), admin.ID, strings.NewReader(`{"is_active": false}`))
+		assert.Equal(t, 200, status)
+
+		var fields []models.CustomField
+		_, body := sendAs(t, app, "GET", fieldsPath, member.ID, nil)
+		json.Unmarshal(body, &fields)
+		assert.Empty(t, fields)
+		_, body = sendAs(t, app, "GET", fieldsPath+"?include_inactive=true", member.ID, nil)
+		json.Unmarshal(body, &fields)
+		assert.Len(t, fields, 1)
+
+		// Inactive fields are no longer required
+		status, _ = createExpense("")
+		assert.Equal(t, 200, status)
+	})
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"fmt"
+	"strings"
+
 	"spendwise-backend/internal/database"
 	"spendwise-backend/internal/models"
 
@@ -14,6 +17,7 @@ func GetDashboardStats(c *fiber.Ctx) error {
 	groupID := c.QueryInt("group_id", 0)
 	memberID := c.QueryInt("member_id", 0)
 	category := c.Query("category")
+	categoryID := c.QueryInt("category_id", 0)
 	startDate := c.Query("start_date") // YYYY-MM-DD
 	endDate := c.Query("end_date")     // YYYY-MM-DD
 
@@ -45,9 +49,13 @@ func GetDashboardStats(c *fiber.Ctx) error {
 	if category != "" {
 		query = query.Where("category = ?", category)
 	}
+	if categoryID > 0 {
+		query = query.Where("category_id = ?", categoryID)
+	}
 	if startDate != "" && endDate != "" {
 		query = query.Where("created_at BETWEEN ? AND ?", startDate+" 00:00:00", endDate+" 23:59:59")
 	}
+	query = applyTagFieldFilters(c, query)
 
 	// Execute Query
 	if err := query.Find(&expenses).Error; err != nil {
@@ -57,10 +65,16 @@ func GetDashboardStats(c *fiber.Ctx) error {
 	totalExpenses := len(expenses)
 	var pendingCount, approvedCount, rejectedCount int
 	var totalAmount float64
-	categoryMap := make(map[string]struct {
+	// Catalogued expenses are grouped by category ID; legacy free-form
+	// categories (category_id NULL) fall back to their name.
+	type categoryBucket struct {
+		ID     uint
+		Name   string
 		Count  int
 		Amount float64
-	})
+	}
+	categoryMap := make(map[string]*categoryBucket)
+	var categoryOrder []string
 	monthlyMap := make(map[string]float64)
 
 	for _, e := range expenses {
@@ -76,10 +90,20 @@ func GetDashboardStats(c *fiber.Ctx) error {
 		}
 
 		// Category Data
-		cat := categoryMap[e.Category]
+		key := "name:" + e.Category
+		var id uint
+		if e.CategoryID != nil {
+			id = *e.CategoryID
+			key = fmt.Sprintf("id:%d", id)
+		}
+		cat, ok := categoryMap[key]
+		if !ok {
+			cat = &categoryBucket{ID: id, Name: e.Category}
+			categoryMap[key] = cat
+			categoryOrder = append(categoryOrder, key)
+		}
 		cat.Count++
 		cat.Amount += e.Amount
-		categoryMap[e.Category] = cat
 
 		// Monthly Data
 		month := e.CreatedAt.Format("Jan")
@@ -87,13 +111,38 @@ func GetDashboardStats(c *fiber.Ctx) error {
 	}
 
 	// Format for frontend
+	var categoryIDs []uint
+	for _, v := range categoryMap {
+		if v.ID > 0 {
+			categoryIDs = append(categoryIDs, v.ID)
+		}
+	}
+	var categories []models.Category
+	if len(categoryIDs) > 0 {
+		database.DB.Where("id IN ?", categoryIDs).Find(&categories)
+	}
+	categoryByID := make(map[uint]models.Category)
+	for _, cat := range categories {
+		categoryByID[cat.ID] = cat
+	}
+
 	var categoryData []map[string]interface{}
-	for k, v := range categoryMap {
-		categoryData = append(categoryData, map[string]interface{}{
-			"name":   k,
+	for _, k := range categoryOrder {
+		v := categoryMap[k]
+		entry := map[string]interface{}{
+			"id":     nil,
+			"name":   v.Name,
 			"value":  v.Count,
 			"amount": v.Amount,
-		})
+		}
+		if cat, ok := categoryByID[v.ID]; ok {
+			entry["id"] = cat.ID
+			entry["name"] = cat.Name
+			entry["icon"] = cat.Icon
+			entry["color"] = cat.Color
+			entry["parent_id"] = cat.ParentID
+		}
+		categoryData = append(categoryData, entry)
 	}
 
 	var monthlyData []map[string]interface{}
@@ -106,7 +155,14 @@ func GetDashboardStats(c *fiber.Ctx) error {
 		})
 	}
 
+	// Optional breakdown by tag (?group_by=tag) or custom field (?group_by=field.<key>)
+	var groupData []map[string]interface{}
+	if groupBy := c.Query("group_by"); groupBy != "" && len(expenses) > 0 {
+		groupData = dashboardBreakdown(expenses, groupBy)
+	}
+
 	return c.JSON(fiber.Map{
+		"groupData":     groupData,
 		"totalExpenses": totalExpenses,
 		"pendingCount":  pendingCount,
 		"approvedCount": approvedCount,
@@ -116,3 +172,53 @@ func GetDashboardStats(c *fiber.Ctx) error {
 		"monthlyData":   monthlyData,
 	})
 }
+
+func dashboardBreakdown(expenses []models.ExpenseRequest, groupBy string) []map[string]interface{} {
+	ids := make([]uint, 0, len(expenses))
+	amountByID := make(map[uint]float64)
+	for _, e := range expenses {
+		ids = append(ids, e.ID)
+		amountByID[e.ID] = e.Amount
+	}
+
+	type pair struct {
+		ExpenseID uint
+		Value     string
+	}
+	var pairs []pair
+	if groupBy == "tag" {
+		database.DB.Model(&models.ExpenseTag{}).Select("expense_id, tag AS value").Where("expense_id IN ?", ids).Scan(&pairs)
+	} else if key, ok := strings.CutPrefix(groupBy, "field."); ok {
+		database.DB.Model(&models.ExpenseFieldValue{}).Select("expense_id, value").Where("expense_id IN ? AND key = ?", ids, key).Scan(&pairs)
+	} else {
+		return nil
+	}
+
+	// An expense with several tags counts towards each of them
+	type bucket struct {
+		Count  int
+		Amount float64
+	}
+	buckets := make(map[string]*bucket)
+	var order []string
+	for _, p := range pairs {
+		b, ok := buckets[p.Value]
+		if !ok {
+			b = &bucket{}
+			buckets[p.Value] = b
+			order = append(order, p.Value)
+		}
+		b.Count++
+		b.Amount += amountByID[p.ExpenseID]
+	}
+
+	result := make([]map[string]interface{}, 0, len(order))
+	for _, name := range order {
+		result = append(result, map[string]interface{}{
+			"name":   name,
+			"value":  buckets[name].Count,
+			"amount": buckets[name].Amount,
+		})
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// findActiveDelegation returns the delegation that lets delegateID act for
+// delegatorID in the given group right now, if any. Group-scoped delegations
+// and global ones (group_id IS NULL) both count.
+func findActiveDelegation(delegatorID, delegateID, groupID uint) (*models.ApprovalDelegation, bool) {
+	now := time.Now()
+	var delegation models.ApprovalDelegation
+	err := database.DB.
+		Where("delegator_id = ? AND delegate_id = ?", delegatorID, delegateID).
+		Where("group_id = ? OR group_id IS NULL", groupID).
+		Where("starts_at <= ? AND ends_at >= ?", now, now).
+		Order("group_id IS NULL"). // Prefer the group-specific delegation
+		First(&delegation).Error
+	if err != nil {
+		return nil, false
+	}
+	return &delegation, true
+}
+
+// resolveDecider checks whether userID may decide on the expense. When the
+// expense has a target approver and userID is acting as their delegate, the
+// target's ID is returned as onBehalfOf. Once an expense is escalated, the
+// escalation target (or any group admin) may decide as well.
+func resolveDecider(expense *models.ExpenseRequest, userID uint) (onBehalfOf *uint, ok bool) {
+	if expense.TargetUserID == nil || *expense.TargetUserID == userID {
+		return nil, true
+	}
+	if _, found := findActiveDelegation(*expense.TargetUserID, userID, expense.GroupID); found {
+		target := *expense.TargetUserID
+		return &target, true
+	}
+	if expense.EscalatedAt != nil {
+		if expense.EscalatedToID != nil {
+			return nil, *expense.EscalatedToID == userID
+		}
+		var count int64
+		database.DB.Model(&models.UserRole{}).
+			Where("group_id = ? AND user_id = ? AND role = ?", expense.GroupID, userID, "admin").
+			Count(&count)
+		return nil, count > 0
+	}
+	return nil, false
+}
+
+// auditMessage renders "approved by X on behalf of Y" style messages,
+// reading the names in the transaction that writes the audit log.
+func auditMessage(tx *gorm.DB, action string, actorID uint, onBehalfOf *uint) string {
+	var actor models.User
+	tx.Select("id", "full_name").First(&actor, actorID)
+	msg := fmt.Sprintf("%s by %s", action, actor.FullName)
+
+	if onBehalfOf != nil {
+		var principal models.User
+		tx.Select("id", "full_name").First(&principal, *onBehalfOf)
+		msg += fmt.Sprintf(" on behalf of %s", principal.FullName)
+	}
+	return msg
+}
+
+func CreateDelegation(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	type CreateDelegationRequest struct {
+		DelegateID uint      `json:"delegate_id" validate:"required"`
+		GroupID    *uint     `json:"group_id"`
+		StartsAt   time.Time `json:"starts_at" validate:"required"`
+		EndsAt     time.Time `json:"ends_at" validate:"required"`
+		Reason     string    `json:"reason" validate:"max=500"`
+	}
+
+	var req CreateDelegationRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	if req.DelegateID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid delegate"})
+	}
+	if !req.EndsAt.After(req.StartsAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ends_at must be after starts_at"})
+	}
+
+	var delegate models.User
+	if err := database.DB.Where("anonymized_at IS NULL").First(&delegate, req.DelegateID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Delegate not found"})
+	}
+
+	if req.GroupID != nil {
+		// Both sides must belong to the group for a group-scoped delegation
+		if activeMemberCount(*req.GroupID, []uint{userID, req.DelegateID}) < 2 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Both users must be members of this group"})
+		}
+	}
+
+	delegation := models.ApprovalDelegation{
+		DelegatorID: userID,
+		DelegateID:  req.DelegateID,
+		GroupID:     req.GroupID,
+		StartsAt:    req.StartsAt,
+		EndsAt:      req.EndsAt,
+		Reason:      req.Reason,
+	}
+
+	if err := database.DB.Create(&delegation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create delegation"})
+	}
+
+	return c.JSON(delegation)
+}
+
+func ListDelegations(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	// Delegations I granted and delegations granted to me
+	delegations := make([]models.ApprovalDelegation, 0)
+	if err := database.DB.Preload("Delegator").Preload("Delegate").Preload("Group").
+		Where("delegator_id = ? OR delegate_id = ?", userID, userID).
+		Order("starts_at desc").
+		Find(&delegations).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch delegations"})
+	}
+
+	return c.JSON(delegations)
+}
+
+func DeleteDelegation(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	delegationID := c.Params("id")
+
+	var delegation models.ApprovalDelegation
+	if err := database.DB.Where("id = ? AND delegator_id = ?", delegationID, userID).First(&delegation).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Delegation not found"})
+	}
+
+	if err := database.DB.Delete(&delegation).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete delegation"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Delegation removed successfully"})
+}
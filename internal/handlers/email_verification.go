@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/mail"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// sendVerificationEmail replaces any earlier verification link of the user
+// with a new one and mails it.
+func sendVerificationEmail(user *models.User) error {
+	ttl := jobs.IntervalFromEnv("EMAIL_VERIFICATION_TTL", 48*time.Hour)
+	token := randomToken(32)
+
+	tx := database.DB.Begin()
+
+	if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	verification := models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&verification).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	link := appURL() + "/verify-email?token=" + url.QueryEscape(token)
+	sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your SpendWise email address",
+		Text: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm that this is your email address by opening:\n\n%s\n\n"+
+			"The link expires in %s. Until then you cannot join groups or top up your wallet.\n",
+			user.FullName, link, ttl),
+	})
+	return nil
+}
+
+// VerifyEmail marks the email address of the token's user as confirmed.
+func VerifyEmail(c *fiber.Ctx) error {
+	type VerifyEmailRequest struct {
+		Token string `json:"token" validate:"required,max=100"`
+	}
+
+	var req VerifyEmailRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var verification models.EmailVerificationToken
+	if err := database.DB.Where("token_hash = ?", hashToken(req.Token)).First(&verification).Error; err != nil ||
+		verification.UsedAt != nil || time.Now().After(verification.ExpiresAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Verification link is invalid or has expired"})
+	}
+
+	now := time.Now()
+	tx := database.DB.Begin()
+
+	claim := tx.Model(&models.EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", verification.ID).
+		Update("used_at", now)
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Verification link is invalid or has expired"})
+	}
+
+	if err := tx.Model(&models.User{}).
+		Where("id = ? AND verified_at IS NULL", verification.UserID).
+		Update("verified_at", now).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not verify email"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{"message": "Email address verified"})
+}
+
+// ResendVerificationEmail sends a new link to the logged-in user.
+func ResendVerificationEmail(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if result := database.DB.First(&user, userID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.VerifiedAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Email address is already verified"})
+	}
+
+	// One email a minute is plenty
+	var recent int64
+	database.DB.Model(&models.EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", user.ID, time.Now().Add(-time.Minute)).
+		Count(&recent)
+	if recent > 0 {
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "A verification email was sent recently; please wait a minute"})
+	}
+
+	if err := sendVerificationEmail(&user); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not send verification email"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Verification email sent"})
+}
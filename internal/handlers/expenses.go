@@ -1,34 +1,64 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"mime/multipart"
 	"strconv"
+	"strings"
 	"time"
 
 	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
 	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/validation"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 func CreateExpense(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
+	// Accepts JSON, or multipart/form-data with the same fields plus any
+	// number of receipt files under "files"
 	type CreateExpenseRequest struct {
-		GroupID        uint    `json:"group_id"`
-		Title          string  `json:"title"`
-		Category       string  `json:"category"`
-		Amount         float64 `json:"amount"`
-		Description    string  `json:"description"`
-		TargetUserID   *uint   `json:"target_user_id"`
-		IsDirectRecord bool    `json:"is_direct_record"`
+		GroupID        uint    `json:"group_id" form:"group_id" validate:"required"`
+		Title          string  `json:"title" form:"title" validate:"required,max=200"`
+		Category       string  `json:"category" form:"category" validate:"max=100"`
+		CategoryID     *uint   `json:"category_id" form:"category_id"`
+		Amount         float64 `json:"amount" form:"amount" validate:"required,gt=0"`
+		Description    string  `json:"description" form:"description" validate:"max=2000"`
+		TargetUserID   *uint   `json:"target_user_id" form:"target_user_id"`
+		IsDirectRecord bool    `json:"is_direct_record" form:"is_direct_record"`
+
+		// Sent as JSON-encoded form values in multipart requests
+		Tags         []string               `json:"tags" form:"-"`
+		CustomFields map[string]interface{} `json:"custom_fields" form:"-"`
+		Split        *SplitRequest          `json:"split" form:"-"`
 	}
 
 	var req CreateExpenseRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+		return badRequest(c, errInvalidBody)
+	}
+
+	var files []*multipart.FileHeader
+	if form, err := c.MultipartForm(); err == nil {
+		if err := parseMultipartJSON(form, "tags", &req.Tags); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tags"})
+		}
+		if err := parseMultipartJSON(form, "custom_fields", &req.CustomFields); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid custom_fields"})
+		}
+		if err := parseMultipartJSON(form, "split", &req.Split); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid split"})
+		}
+		files = form.File["files"]
+	}
+	if err := validation.Struct(&req); err != nil {
+		return badRequest(c, err)
 	}
 
 	// Verify membership
@@ -36,6 +66,44 @@ func CreateExpense(c *fiber.Ctx) error {
 	if err := database.DB.Where("group_id = ? AND user_id = ?", req.GroupID, userID).First(&member).Error; err != nil {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
 	}
+	if !apiKeyAllowsGroup(c, req.GroupID) {
+		return apiKeyGroupDenied(c)
+	}
+
+	if req.TargetUserID != nil && activeMemberCount(req.GroupID, []uint{*req.TargetUserID}) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The approver must be a member of this group"})
+	}
+
+	// Validate against the group's category catalog
+	category, msg := resolveCategory(req.GroupID, req.CategoryID, req.Category)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	var categoryID *uint
+	if category != nil {
+		categoryID = &category.ID
+		req.Category = category.Name
+	}
+
+	// Validate tags and the group's custom fields
+	tags, msg := normalizeTags(req.Tags)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	fieldValues, msg := validateFieldValues(req.GroupID, req.CustomFields)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+
+	// Work out each participant's share when the expense is split
+	var splits []models.ExpenseSplit
+	splitMethod := ""
+	if req.Split != nil && len(req.Split.Participants) > 0 {
+		if splits, msg = buildSplits(req.GroupID, req.Amount, req.Split); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+		splitMethod = req.Split.Method
+	}
 
 	status := "pending"
 	var approvedBy *uint
@@ -53,14 +121,59 @@ func CreateExpense(c *fiber.Ctx) error {
 		RequesterID:  userID,
 		Title:        req.Title,
 		Category:     req.Category,
+		CategoryID:   categoryID,
 		Amount:       req.Amount,
 		Description:  req.Description,
+		SplitMethod:  splitMethod,
 		Status:       status,
 		TargetUserID: req.TargetUserID,
 		ApprovedBy:   approvedBy,
 		ApprovedAt:   approvedAt,
 	}
 
+	// Warn about (or refuse) spending that pushes a group budget over its threshold
+	alerts, blocked := jobs.CheckBudgets(&expense)
+	if blocked {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Budget limit exceeded", "budget_alerts": alerts})
+	}
+	expense.BudgetWarnings = alerts
+
+	// Store receipts first; they are deleted again unless the transaction commits
+	committed := false
+	var stored []*storedUpload
+	defer func() {
+		if !committed {
+			for _, s := range stored {
+				deleteUpload(s)
+			}
+		}
+	}()
+
+	attachments := make([]models.ExpenseAttachment, 0, len(files))
+	seen := make(map[string]bool)
+	for _, file := range files {
+		s, err := storeUpload(file, upload.Attachment, "attachments", req.GroupID)
+		if err != nil {
+			return uploadError(c, err)
+		}
+		if seen[s.SHA256] {
+			deleteUpload(s) // Same file twice in one request
+			continue
+		}
+		seen[s.SHA256] = true
+		stored = append(stored, s)
+		attachments = append(attachments, models.ExpenseAttachment{
+			FileName:      s.Name,
+			FilePath:      s.Key,
+			ThumbnailPath: s.Variants["thumb"],
+			FileSize:      s.Size,
+			FileType:      s.ContentType,
+			SHA256:        s.SHA256,
+			UploadedBy:    userID,
+			UploadedAt:    time.Now(),
+		})
+	}
+
 	tx := database.DB.Begin()
 
 	if err := tx.Create(&expense).Error; err != nil {
@@ -68,16 +181,32 @@ func CreateExpense(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create expense"})
 	}
 
-	if req.IsDirectRecord {
-		// Deduct from Creator's Wallet
-		var user models.User
-		if err := tx.First(&user, userID).Error; err != nil {
+	for i := range attachments {
+		if err := claimUpload(tx, stored[i]); err != nil {
 			tx.Rollback()
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "User not found"})
+			return uploadError(c, err)
 		}
+		attachments[i].ExpenseID = expense.ID
+		if err := tx.Create(&attachments[i]).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save attachment record"})
+		}
+	}
+
+	if err := saveTagsAndFields(tx, expense.ID, tags, fieldValues); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save tags and custom fields"})
+	}
 
-		user.WalletBalance -= req.Amount
-		if err := tx.Save(&user).Error; err != nil {
+	if err := saveSplits(tx, expense.ID, splits); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save expense split"})
+	}
+
+	if req.IsDirectRecord {
+		// Deduct from Creator's Wallet
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("wallet_balance", gorm.Expr("wallet_balance - ?", req.Amount)).Error; err != nil {
 			tx.Rollback()
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update wallet balance"})
 		}
@@ -98,7 +227,20 @@ func CreateExpense(c *fiber.Ctx) error {
 		}
 	}
 
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create expense"})
+	}
+	committed = true
+
+	database.DB.Where("expense_id = ?", expense.ID).Find(&expense.Tags)
+	database.DB.Where("expense_id = ?", expense.ID).Find(&expense.FieldValues)
+	expense.Splits = splits
+
+	for i := range attachments {
+		attachments[i].Extraction = queueReceipt(&attachments[i])
+	}
+	markReusedReceipts(expense.GroupID, attachments)
+	expense.Attachments = attachments
 
 	return c.JSON(expense)
 }
@@ -116,13 +258,17 @@ func ListExpenses(c *fiber.Ctx) error {
 	memberID := c.QueryInt("member_id", 0)
 	status := c.Query("status")
 	category := c.Query("category")
+	categoryID := c.QueryInt("category_id", 0)
 	startDate := c.Query("start_date")
 	endDate := c.Query("end_date")
 	search := c.Query("search")
 
 	query := database.DB.Model(&models.ExpenseRequest{}).
 		Preload("Requester").
-		Preload("TargetUser")
+		Preload("TargetUser").
+		Preload("CategoryRef").
+		Preload("Tags").
+		Preload("FieldValues")
 
 	// Scope Logic
 	if scope == "group" && groupID > 0 {
@@ -149,6 +295,11 @@ func ListExpenses(c *fiber.Ctx) error {
 		}
 	}
 
+	// API keys restricted to a group only see that group
+	if restricted, ok := apiKeyGroup(c); ok {
+		query = query.Where("group_id = ?", restricted)
+	}
+
 	// Common Filters
 	if status != "" && status != "all" {
 		query = query.Where("status = ?", status)
@@ -156,12 +307,16 @@ func ListExpenses(c *fiber.Ctx) error {
 	if category != "" && category != "all" {
 		query = query.Where("category = ?", category)
 	}
+	if categoryID > 0 {
+		query = query.Where("category_id = ?", categoryID)
+	}
 	if startDate != "" && endDate != "" {
 		query = query.Where("created_at BETWEEN ? AND ?", startDate+" 00:00:00", endDate+" 23:59:59")
 	}
 	if search != "" {
 		query = query.Where("title ILIKE ? OR description ILIKE ?", "%"+search+"%", "%"+search+"%")
 	}
+	query = applyTagFieldFilters(c, query)
 
 	// Count Total
 	var total int64
@@ -188,10 +343,15 @@ func ListExpenses(c *fiber.Ctx) error {
 func GetExpense(c *fiber.Ctx) error {
 	id := c.Params("id")
 	var expense models.ExpenseRequest
-	// Preload Attachments and ApprovalSlips
-	if err := database.DB.Preload("Requester").Preload("Attachments").Preload("ApprovalSlips").First(&expense, id).Error; err != nil {
+	// Preload Attachments, ApprovalSlips and the decision/escalation trail
+	if err := database.DB.Preload("Requester").Preload("Attachments.Extraction").Preload("ApprovalSlips").Preload("AuditLogs").Preload("Escalations").
+		Preload("Tags").Preload("FieldValues").Preload("Splits.User").First(&expense, id).Error; err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
 	}
+	if !apiKeyAllowsGroup(c, expense.GroupID) {
+		return apiKeyGroupDenied(c)
+	}
+	markReusedReceipts(expense.GroupID, expense.Attachments)
 	return c.JSON(expense)
 }
 
@@ -203,39 +363,80 @@ func UploadAttachment(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid expense_id"})
 	}
 
+	expense, err := loadEditableExpense(expenseID, userID)
+	if err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
 	file, err := c.FormFile("file")
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No file uploaded"})
 	}
 
-	// Ensure upload directory exists
-	uploadDir := "./uploads"
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		os.Mkdir(uploadDir, 0755)
+	stored, err := storeUpload(file, upload.Attachment, "attachments", expense.GroupID)
+	if err != nil {
+		return uploadError(c, err)
 	}
-
-	// Generate unique filename
-	filename := fmt.Sprintf("%d_%d_%s", userID, time.Now().Unix(), file.Filename)
-	filepath := filepath.Join(uploadDir, filename)
-
-	if err := c.SaveFile(file, filepath); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save file"})
+	if duplicate := findDuplicateAttachment(expense.ID, stored.SHA256, 0); duplicate != nil {
+		deleteUpload(stored)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "This file is already attached to the expense", "attachment": duplicate})
 	}
 
 	// Save record
 	attachment := models.ExpenseAttachment{
-		ExpenseID:  uint(expenseID),
-		FileName:   file.Filename,
-		FilePath:   "/uploads/" + filename,
-		FileSize:   file.Size,
-		FileType:   file.Header.Get("Content-Type"),
-		UploadedBy: userID,
-		UploadedAt: time.Now(),
+		ExpenseID:     expense.ID,
+		FileName:      stored.Name,
+		FilePath:      stored.Key,
+		ThumbnailPath: stored.Variants["thumb"],
+		FileSize:      stored.Size,
+		FileType:      stored.ContentType,
+		SHA256:        stored.SHA256,
+		UploadedBy:    userID,
+		UploadedAt:    time.Now(),
 	}
 
-	if err := database.DB.Create(&attachment).Error; err != nil {
+	tx := database.DB.Begin()
+
+	if err := claimUpload(tx, stored); err != nil {
+		tx.Rollback()
+		return uploadError(c, err)
+	}
+	if err := tx.Create(&attachment).Error; err != nil {
+		tx.Rollback()
+		deleteUpload(stored)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save attachment record"})
+	}
+	if err := tx.Commit().Error; err != nil {
+		deleteUpload(stored)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save attachment record"})
 	}
 
-	return c.JSON(attachment)
+	// Read the receipt in the background so the client can prefill title,
+	// amount and date
+	attachment.Extraction = queueReceipt(&attachment)
+	attachments := []models.ExpenseAttachment{attachment}
+	markReusedReceipts(expense.GroupID, attachments)
+
+	return c.JSON(attachments[0])
+}
+
+// parseMultipartJSON decodes a JSON-encoded form value into dst. Tags may
+// also be sent as plain repeated or comma-separated values.
+func parseMultipartJSON(form *multipart.Form, key string, dst interface{}) error {
+	values := form.Value[key]
+	if len(values) == 0 || values[0] == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(values[0]), dst); err == nil {
+		return nil
+	}
+
+	if tags, ok := dst.(*[]string); ok {
+		for _, v := range values {
+			*tags = append(*tags, strings.Split(v, ",")...)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s must be valid JSON", key)
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"testing"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// multipartExpense builds a create-expense form with the given fields and
+// receipt files.
+func multipartExpense(fields map[string]string, files map[string][]byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range fields {
+		w.WriteField(name, value)
+	}
+	for name, data := range files {
+		part, _ := w.CreateFormFile("files", name)
+		part.Write(data)
+	}
+	w.Close()
+	return &body, w.FormDataContentType()
+}
+
+func TestCreateExpenseWithReceipts(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Post("/expenses", asTestUser, CreateExpense)
+
+	user := createTestUser("multipart@example.com", false)
+	group := createTestGroup("multipart", false, user, map[uint]string{user.ID: "admin"})
+
+	var receipt bytes.Buffer
+	png.Encode(&receipt, image.NewGray(image.Rect(0, 0, 40, 60)))
+
+	fields := map[string]string{
+		"group_id": fmt.Sprint(group.ID),
+		"title":    "Taxi",
+		"category": "Travel",
+		"amount":   "18.5",
+		"tags":     `["airport"]`,
+	}
+
+	t.Run("Fields And Receipts Together", func(t *testing.T) {
+		body, contentType := multipartExpense(fields, map[string][]byte{
+			"receipt.png": receipt.Bytes(),
+			"copy.png":    receipt.Bytes(), // Same file twice is stored once
+		})
+		status, data := sendAs(t, app, "POST", "/expenses", user.ID, body, contentType)
+		assert.Equal(t, 200, status, string(data))
+
+		var expense models.ExpenseRequest
+		json.Unmarshal(data, &expense)
+		assert.Equal(t, 18.5, expense.Amount)
+		if assert.Len(t, expense.Tags, 1) {
+			assert.Equal(t, "airport", expense.Tags[0].Tag)
+		}
+		if assert.Len(t, expense.Attachments, 1) {
+			var stored models.ExpenseAttachment
+			database.DB.First(&stored, expense.Attachments[0].ID)
+			assert.Equal(t, "image/png", stored.FileType)
+
+			r, err := storage.Files.Get(context.Background(), stored.FilePath)
+			if assert.NoError(t, err) {
+				r.Close()
+			}
+		}
+	})
+
+	t.Run("Invalid Receipt Stores Nothing", func(t *testing.T) {
+		body, contentType := multipartExpense(fields, map[string][]byte{"receipt.exe": []byte("MZ not a receipt")})
+		status, _ := sendAs(t, app, "POST", "/expenses", user.ID, body, contentType)
+		assert.Equal(t, 415, status)
+
+		var count int64
+		database.DB.Model(&models.ExpenseRequest{}).Where("group_id = ?", group.ID).Count(&count)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("Invalid JSON Field", func(t *testing.T) {
+		broken := map[string]string{"split": "{not json"}
+		for k, v := range fields {
+			broken[k] = v
+		}
+		body, contentType := multipartExpense(broken, nil)
+		status, _ := sendAs(t, app, "POST", "/expenses", user.ID, body, contentType)
+		assert.Equal(t, 400, status)
+	})
+}
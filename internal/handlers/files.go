@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loadSlipForMember fetches an approval slip if the user belongs to the
+// group of the expense it was uploaded for.
+func loadSlipForMember(slipID string, userID uint) (*models.ApprovalSlip, error) {
+	var slip models.ApprovalSlip
+	if err := database.DB.First(&slip, slipID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Slip not found")
+	}
+
+	var expense models.ExpenseRequest
+	if err := database.DB.First(&expense, slip.ExpenseID).Error; err != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Expense not found")
+	}
+
+	var memberCount int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", expense.GroupID, userID).Count(&memberCount)
+	if memberCount == 0 {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Not a member of this group")
+	}
+	return &slip, nil
+}
+
+// inlineTypes are the only content types shown in the browser. Anything
+// else, HTML and SVG above all, could run script on our origin and is sent
+// as a download.
+var inlineTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// sendStoredFile streams an object from the storage backend under its
+// original filename. fileType may come from an old client-supplied upload
+// and is only trusted when it is on the inline list.
+func sendStoredFile(c *fiber.Ctx, key, fileName, fileType string) error {
+	r, err := storage.Files.Get(c.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not read file"})
+	}
+
+	if fileType == "" {
+		fileType = mime.TypeByExtension(path.Ext(key))
+	}
+	fileType, _, _ = strings.Cut(fileType, ";")
+	fileType = strings.ToLower(strings.TrimSpace(fileType))
+	disposition := "inline"
+	if !inlineTypes[fileType] {
+		fileType, disposition = "application/octet-stream", "attachment"
+	}
+
+	// Quotes and control characters in user filenames would break the header
+	safeName := strings.Map(func(r rune) rune {
+		if r < 0x20 || r == '"' || r == '\\' || r == 0x7f {
+			return '_'
+		}
+		return r
+	}, fileName)
+	c.Set(fiber.HeaderContentType, fileType)
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`%s; filename="%s"`, disposition, safeName))
+	c.Set(fiber.HeaderCacheControl, "private, max-age=300")
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	return c.SendStream(r)
+}
+
+func DownloadAttachment(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	attachment, _, err := loadAttachmentForMember(c.Params("id"), userID)
+	if err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	return sendStoredFile(c, attachment.FilePath, attachment.FileName, attachment.FileType)
+}
+
+func DownloadAttachmentThumbnail(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	attachment, _, err := loadAttachmentForMember(c.Params("id"), userID)
+	if err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	return sendThumbnail(c, attachment)
+}
+
+func sendThumbnail(c *fiber.Ctx, attachment *models.ExpenseAttachment) error {
+	if attachment.ThumbnailPath == "" {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No thumbnail for this attachment"})
+	}
+	return sendStoredFile(c, attachment.ThumbnailPath, "thumb_"+attachment.FileName, "image/jpeg")
+}
+
+func DownloadSlip(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	slip, err := loadSlipForMember(c.Params("id"), userID)
+	if err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+
+	return sendStoredFile(c, slip.FilePath, slip.FileName, slip.FileType)
+}
+
+// signedFilePath is the unauthenticated route served by ServeSignedFile.
+func signedFilePath(kind string, id uint) string {
+	return fmt.Sprintf("/api/files/%s/%d", kind, id)
+}
+
+// GetSignedFileURL returns a short-lived URL for an attachment or slip that
+// works without an Authorization header, e.g. in <img src>.
+func GetSignedFileURL(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	kind := c.Params("kind")
+
+	var id uint
+	switch kind {
+	case "attachments", "thumbnails":
+		attachment, _, err := loadAttachmentForMember(c.Params("id"), userID)
+		if err != nil {
+			e := err.(*fiber.Error)
+			return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+		}
+		id = attachment.ID
+	case "slips":
+		slip, err := loadSlipForMember(c.Params("id"), userID)
+		if err != nil {
+			e := err.(*fiber.Error)
+			return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+		}
+		id = slip.ID
+	default:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown file type"})
+	}
+
+	expiresAt := time.Now().Add(jobs.IntervalFromEnv("SIGNED_URL_TTL", 5*time.Minute))
+	return c.JSON(fiber.Map{
+		"url":        storage.SignURL(signedFilePath(kind, id), expiresAt),
+		"expires_at": expiresAt,
+	})
+}
+
+// ServeSignedFile serves a file through a URL from GetSignedFileURL. The
+// signature stands in for authentication, so no token is needed.
+func ServeSignedFile(c *fiber.Ctx) error {
+	kind := c.Params("kind")
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	if !storage.VerifySignedURL(signedFilePath(kind, uint(id)), c.Query("expires"), c.Query("sig"), time.Now()) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Invalid or expired link"})
+	}
+
+	switch kind {
+	case "attachments":
+		var attachment models.ExpenseAttachment
+		if err := database.DB.First(&attachment, id).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+		}
+		return sendStoredFile(c, attachment.FilePath, attachment.FileName, attachment.FileType)
+	case "thumbnails":
+		var attachment models.ExpenseAttachment
+		if err := database.DB.First(&attachment, id).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+		}
+		return sendThumbnail(c, &attachment)
+	case "slips":
+		var slip models.ApprovalSlip
+		if err := database.DB.First(&slip, id).Error; err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+		}
+		return sendStoredFile(c, slip.FilePath, slip.FileName, slip.FileType)
+	}
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendStoredFileDisposition(t *testing.T) {
+	app := setupApp()
+	app.Get("/files/:name", func(c *fiber.Ctx) error {
+		types := map[string]string{
+			"receipt.png": "image/png",
+			"receipt.pdf": "application/pdf; charset=binary",
+			"page.html":   "text/html",
+			"logo.svg":    "image/svg+xml",
+			"avatar.jpg":  "",
+		}
+		return sendStoredFile(c, "test/"+c.Params("name"), c.Params("name"), types[c.Params("name")])
+	})
+
+	for _, name := range []string{"receipt.png", "receipt.pdf", "page.html", "logo.svg", "avatar.jpg"} {
+		storage.Files.Put(context.Background(), "test/"+name, strings.NewReader("<script>alert(1)</script>"), 25, "")
+	}
+
+	get := func(name string) (string, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", "/files/"+name, nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+		return resp.Header.Get("Content-Type"), resp.Header.Get("Content-Disposition")
+	}
+
+	t.Run("Images And PDFs Are Inline", func(t *testing.T) {
+		contentType, disposition := get("receipt.png")
+		assert.Equal(t, "image/png", contentType)
+		assert.True(t, strings.HasPrefix(disposition, "inline"))
+
+		contentType, disposition = get("receipt.pdf")
+		assert.Equal(t, "application/pdf", contentType)
+		assert.True(t, strings.HasPrefix(disposition, "inline"))
+
+		contentType, _ = get("avatar.jpg")
+		assert.Equal(t, "image/jpeg", contentType)
+	})
+
+	t.Run("Markup Is Downloaded", func(t *testing.T) {
+		for _, name := range []string{"page.html", "logo.svg"} {
+			contentType, disposition := get(name)
+			assert.Equal(t, "application/octet-stream", contentType)
+			assert.True(t, strings.HasPrefix(disposition, "attachment"))
+		}
+	})
+}
+
+func TestReusedReceiptsStayInGroup(t *testing.T) {
+	setupTestDB()
+
+	user := createTestUser("receipts@example.com", false)
+	ours := createTestGroup("receipts-ours", false, user, map[uint]string{user.ID: "admin"})
+	theirs := createTestGroup("receipts-theirs", false, user, map[uint]string{user.ID: "admin"})
+
+	attach := func(group models.ExpenseGroup) models.ExpenseAttachment {
+		expense := models.ExpenseRequest{GroupID: group.ID, RequesterID: user.ID, Title: "Lunch", Amount: 12, Status: "pending"}
+		database.DB.Create(&expense)
+		attachment := models.ExpenseAttachment{ExpenseID: expense.ID, FileName: "lunch.png", FilePath: "attachments/lunch.png", SHA256: "abc123", UploadedBy: user.ID}
+		database.DB.Create(&attachment)
+		return attachment
+	}
+
+	first := attach(ours)
+	attach(theirs)
+
+	// The same receipt in another group is not reported
+	attachments := []models.ExpenseAttachment{first}
+	markReusedReceipts(ours.ID, attachments)
+	assert.False(t, attachments[0].ReusedElsewhere)
+	assert.Empty(t, attachments[0].ReusedInExpenseIDs)
+
+	second := attach(ours)
+	markReusedReceipts(ours.ID, attachments)
+	assert.True(t, attachments[0].ReusedElsewhere)
+	assert.Equal(t, []uint{second.ExpenseID}, attachments[0].ReusedInExpenseIDs)
+
+	// Dropping one reference keeps the shared object for the others
+	tx := database.DB.Begin()
+	tx.Delete(&second)
+	unused, err := releaseObjects(tx, second.FilePath)
+	tx.Commit()
+	assert.NoError(t, err)
+	assert.Empty(t, unused)
+}
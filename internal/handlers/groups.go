@@ -20,17 +20,29 @@ func generateInviteCode() string {
 	return hex.EncodeToString(bytes)
 }
 
+// activeMemberCount counts how many of userIDs belong to the group with an
+// account that still exists. Deleted accounts keep their membership for the
+// group's ledger but can no longer be picked to approve, pay or share.
+func activeMemberCount(groupID uint, userIDs []uint) int64 {
+	var count int64
+	database.DB.Model(&models.GroupMember{}).
+		Joins("JOIN users ON users.id = group_members.user_id").
+		Where("group_members.group_id = ? AND group_members.user_id IN ? AND users.anonymized_at IS NULL", groupID, userIDs).
+		Count(&count)
+	return count
+}
+
 func CreateGroup(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
 	type CreateGroupRequest struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name        string `json:"name" validate:"required,max=100"`
+		Description string `json:"description" validate:"max=1000"`
 	}
 
 	var req CreateGroupRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	group := models.ExpenseGroup{
@@ -69,6 +81,12 @@ func CreateGroup(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not add role"})
 	}
 
+	// Start with a default category catalog
+	if err := seedCategories(tx, group.ID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create categories"})
+	}
+
 	tx.Commit()
 
 	return c.JSON(group)
@@ -89,13 +107,15 @@ func ListGroups(c *fiber.Ctx) error {
 		database.DB.Model(&models.GroupMember{}).Where("group_id = ?", m.GroupID).Count(&count)
 
 		groups = append(groups, map[string]interface{}{
-			"id":           m.Group.ID,
-			"name":         m.Group.Name,
-			"description":  m.Group.Description,
-			"invite_code":  m.Group.InviteCode,
-			"created_by":   m.Group.CreatedBy,
-			"created_at":   m.Group.CreatedAt,
-			"member_count": count,
+			"id":                   m.Group.ID,
+			"name":                 m.Group.Name,
+			"description":          m.Group.Description,
+			"invite_code":          m.Group.InviteCode,
+			"created_by":           m.Group.CreatedBy,
+			"created_at":           m.Group.CreatedAt,
+			"member_count":         count,
+			"approval_sla_hours":   m.Group.ApprovalSLAHours,
+			"fallback_approver_id": m.Group.FallbackApproverID,
 		})
 	}
 
@@ -106,12 +126,12 @@ func JoinGroup(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
 	type JoinRequest struct {
-		InviteCode string `json:"invite_code"`
+		InviteCode string `json:"invite_code" validate:"required,max=64"`
 	}
 
 	var req JoinRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	var group models.ExpenseGroup
@@ -173,14 +193,27 @@ func GetGroupMembers(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch group members"})
 	}
 
+	// Per-member balances from split expenses
+	balances, err := groupBalances(member.GroupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not calculate balances"})
+	}
+
 	var result []map[string]interface{}
 	for _, m := range members {
+		balance := balances[m.UserID]
+		if balance == nil {
+			balance = &memberBalance{}
+		}
 		result = append(result, map[string]interface{}{
 			"id":         m.User.ID,
 			"full_name":  m.User.FullName,
 			"email":      m.User.Email,
 			"avatar_url": m.User.AvatarURL,
 			"joined_at":  m.JoinedAt,
+			"owes":       balance.Owes,
+			"is_owed":    balance.IsOwed,
+			"net":        balance.Net(),
 		})
 	}
 
@@ -197,13 +230,16 @@ func UpdateGroup(c *fiber.Ctx) error {
 	}
 
 	type UpdateGroupRequest struct {
-		Name        string `json:"name"`
-		Description string `json:"description"`
+		Name               *string `json:"name" validate:"notblank,max=100"`
+		Description        *string `json:"description" validate:"max=1000"`
+		ApprovalSLAHours   *int    `json:"approval_sla_hours" validate:"min=0"`
+		FallbackApproverID *uint   `json:"fallback_approver_id"`
+		RequireTwoFactor   *bool   `json:"require_two_factor"`
 	}
 
 	var req UpdateGroupRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	var group models.ExpenseGroup
@@ -211,8 +247,37 @@ func UpdateGroup(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Group not found"})
 	}
 
-	group.Name = req.Name
-	group.Description = req.Description
+	// Only the fields sent are changed
+	if req.Name != nil {
+		group.Name = *req.Name
+	}
+	if req.Description != nil {
+		group.Description = *req.Description
+	}
+	if req.ApprovalSLAHours != nil {
+		group.ApprovalSLAHours = *req.ApprovalSLAHours
+	}
+	if req.FallbackApproverID != nil {
+		if *req.FallbackApproverID == 0 {
+			group.FallbackApproverID = nil
+		} else {
+			if activeMemberCount(group.ID, []uint{*req.FallbackApproverID}) == 0 {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Fallback approver must be a member of this group"})
+			}
+			group.FallbackApproverID = req.FallbackApproverID
+		}
+	}
+
+	if req.RequireTwoFactor != nil {
+		// Admins turning it on must not lock themselves out
+		if *req.RequireTwoFactor && !group.RequireTwoFactor {
+			var admin models.User
+			if err := database.DB.Select("id", "totp_enabled_at").First(&admin, userID).Error; err != nil || admin.TOTPEnabledAt == nil {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Enable two-factor authentication on your own account first"})
+			}
+		}
+		group.RequireTwoFactor = *req.RequireTwoFactor
+	}
 
 	if err := database.DB.Save(&group).Error; err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update group"})
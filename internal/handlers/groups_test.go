@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateGroupChangesOnlyWhatIsSent(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Put("/groups/:id", asTestUser, UpdateGroup)
+
+	admin := createTestUser("group-admin@example.com", false)
+	group := createTestGroup("partial", false, admin, map[uint]string{admin.ID: "admin"})
+	database.DB.Model(&group).Update("description", "Team lunches")
+
+	update := func(payload string) (int, models.ExpenseGroup) {
+		status, data := sendAs(t, app, "PUT", fmt.Sprintf("/groups/%d", group.ID), admin.ID, strings.NewReader(payload))
+		var body models.ExpenseGroup
+		json.Unmarshal(data, &body)
+		return status, body
+	}
+
+	t.Run("Settings Only", func(t *testing.T) {
+		status, body := update(`{"approval_sla_hours": 24}`)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "partial", body.Name)
+		assert.Equal(t, "Team lunches", body.Description)
+		assert.Equal(t, 24, body.ApprovalSLAHours)
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		status, body := update(`{"name": "Lunches"}`)
+		assert.Equal(t, 200, status)
+		assert.Equal(t, "Lunches", body.Name)
+		assert.Equal(t, "Team lunches", body.Description)
+	})
+
+	t.Run("Blank Name", func(t *testing.T) {
+		status, _ := update(`{"name": "  "}`)
+		assert.Equal(t, 400, status)
+	})
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/oidc"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// oidcStateTTL bounds how long a user may spend at the provider.
+const oidcStateTTL = 10 * time.Minute
+
+// oidcStateCookie ties a login to the browser that started it, so nobody can
+// hand someone else a callback URL that logs them into another account.
+const oidcStateCookie = "oidc_state"
+
+func setOIDCStateCookie(c *fiber.Ctx, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/auth/oidc/",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   strings.HasPrefix(appURL(), "https://"),
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+var (
+	ssoOnce      sync.Once
+	ssoProviders map[string]*oidc.Provider
+)
+
+// identityProviders reads the OIDC configuration on first use, after .env
+// is loaded. A broken configuration disables SSO instead of the server.
+func identityProviders() map[string]*oidc.Provider {
+	ssoOnce.Do(func() {
+		providers, err := oidc.ProvidersFromEnv(appURL())
+		if err != nil {
+			log.Printf("SSO disabled: %v", err)
+			providers = map[string]*oidc.Provider{}
+		}
+		ssoProviders = providers
+	})
+	return ssoProviders
+}
+
+// ListIdentityProviders tells the login page which SSO buttons to show.
+func ListIdentityProviders(c *fiber.Ctx) error {
+	list := make([]fiber.Map, 0)
+	for _, p := range identityProviders() {
+		list = append(list, fiber.Map{
+			"name":         p.Name,
+			"display_name": p.DisplayName,
+			"login_url":    "/api/auth/oidc/" + p.Name + "/login",
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i]["name"].(string) < list[j]["name"].(string) })
+	return c.JSON(list)
+}
+
+// safeRedirectPath keeps post-login redirects on our own frontend.
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
+
+// StartOIDCLogin sends the browser to the provider's login page.
+func StartOIDCLogin(c *fiber.Ctx) error {
+	provider, ok := identityProviders()[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	}
+
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+	record := models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Provider:     provider.Name,
+		CodeVerifier: verifier,
+		Nonce:        nonce,
+		RedirectPath: safeRedirectPath(c.Query("redirect", "/")),
+		ExpiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	if err := database.DB.Create(&record).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not start login"})
+	}
+
+	// Abandoned attempts are not worth a job of their own
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+
+	setOIDCStateCookie(c, record.StateHash, record.ExpiresAt)
+
+	ctx, cancel := context.WithTimeout(c.Context(), 10*time.Second)
+	defer cancel()
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("SSO login with %s failed: %v", provider.Name, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Identity provider is unavailable"})
+	}
+
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// redirectToApp hands the login result to the frontend in the URL
+// fragment, which browsers do not send to servers.
+func redirectToApp(c *fiber.Ctx, path string, values url.Values) error {
+	return c.Redirect(appURL()+"/auth/callback?redirect="+url.QueryEscape(path)+"#"+values.Encode(), fiber.StatusFound)
+}
+
+// OIDCCallback finishes an SSO login: it checks the state, exchanges the
+// code, finds or creates the user and starts a session.
+func OIDCCallback(c *fiber.Ctx) error {
+	provider, ok := identityProviders()[c.Params("provider")]
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown identity provider"})
+	}
+
+	// The state must come back to the browser that started the login
+	stateHash := hashToken(c.Query("state"))
+	cookie := c.Cookies(oidcStateCookie)
+	setOIDCStateCookie(c, "", time.Unix(0, 0))
+	if subtle.ConstantTimeCompare([]byte(cookie), []byte(stateHash)) != 1 {
+		return redirectToApp(c, "/", url.Values{"error": {"invalid_state"}})
+	}
+
+	// The state is single-use: whoever deletes it owns the login
+	var state models.OIDCLoginState
+	if err := database.DB.Where("state_hash = ? AND provider = ?", stateHash, provider.Name).First(&state).Error; err != nil {
+		return redirectToApp(c, "/", url.Values{"error": {"invalid_state"}})
+	}
+	claim := database.DB.Where("id = ?", state.ID).Delete(&models.OIDCLoginState{})
+	if claim.Error != nil || claim.RowsAffected == 0 || time.Now().After(state.ExpiresAt) {
+		return redirectToApp(c, "/", url.Values{"error": {"invalid_state"}})
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		return redirectToApp(c, state.RedirectPath, url.Values{"error": {errCode}})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 15*time.Second)
+	defer cancel()
+	claims, err := provider.Exchange(ctx, c.Query("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("SSO callback from %s failed: %v", provider.Name, err)
+		return redirectToApp(c, state.RedirectPath, url.Values{"error": {"login_failed"}})
+	}
+
+	user, err := userForIdentity(provider.Name, claims)
+	if err != nil {
+		var e *fiber.Error
+		if errors.As(err, &e) {
+			return redirectToApp(c, state.RedirectPath, url.Values{"error": {e.Message}})
+		}
+		log.Printf("SSO login with %s failed: %v", provider.Name, err)
+		return redirectToApp(c, state.RedirectPath, url.Values{"error": {"login_failed"}})
+	}
+
+	// SSO replaces the password, not the second factor
+	if user.TOTPEnabledAt != nil {
+		challenge, err := signChallengeToken(user, "")
+		if err != nil {
+			return redirectToApp(c, state.RedirectPath, url.Values{"error": {"login_failed"}})
+		}
+		return redirectToApp(c, state.RedirectPath, url.Values{
+			"two_factor_required": {"true"},
+			"challenge_token":     {challenge},
+		})
+	}
+
+	tokens, e := newLogin(c, user, "")
+	if e != nil {
+		return redirectToApp(c, state.RedirectPath, url.Values{"error": {"login_failed"}})
+	}
+	return redirectToApp(c, state.RedirectPath, url.Values{
+		"token":         {tokens["token"].(string)},
+		"refresh_token": {tokens["refresh_token"].(string)},
+	})
+}
+
+// userForIdentity returns the user linked to a provider account. Unknown
+// accounts are linked to the user with the same email when the provider
+// vouches for the address, or get a new user without a password. Linking an
+// account whose email was never verified resets its password, second factor
+// and sessions.
+func userForIdentity(provider string, claims *oidc.Claims) (*models.User, error) {
+	var user models.User
+
+	var identity models.UserIdentity
+	err := database.DB.Where("provider = ? AND subject = ?", provider, claims.Subject).First(&identity).Error
+	if err == nil {
+		if err := database.DB.First(&user, identity.UserID).Error; err != nil {
+			return nil, err
+		}
+		database.DB.Model(&identity).Updates(map[string]interface{}{"last_login_at": time.Now(), "email": claims.Email})
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "email_required")
+	}
+
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("LOWER(email) = LOWER(?)", claims.Email).First(&user).Error
+		switch {
+		case err == nil:
+			// Linking by an unverified address would let anyone take over
+			// the account by claiming its email at the provider
+			if !claims.EmailVerified {
+				return fiber.NewError(fiber.StatusConflict, "email_not_verified")
+			}
+			// Nobody proved they own an unverified account, so someone may
+			// have registered it first with the owner's address. The owner
+			// takes it over: whatever the squatter set up to sign in goes.
+			if user.VerifiedAt == nil {
+				user.VerifiedAt = &now
+				user.PasswordHash = ""
+				user.TOTPSecret = ""
+				user.TOTPEnabledAt = nil
+				if err := tx.Model(&user).Updates(map[string]interface{}{
+					"verified_at":     now,
+					"password_hash":   "",
+					"totp_secret":     "",
+					"totp_enabled_at": nil,
+				}).Error; err != nil {
+					return err
+				}
+				if err := invalidateUserTokens(tx, &user); err != nil {
+					return err
+				}
+				if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			fullName := claims.Name
+			if fullName == "" {
+				fullName = strings.SplitN(claims.Email, "@", 2)[0]
+			}
+			// No password: log in through SSO, or set one with a reset link
+			user = models.User{Email: claims.Email, FullName: fullName}
+			if claims.EmailVerified {
+				user.VerifiedAt = &now
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if user.VerifiedAt == nil {
+		if err := sendVerificationEmail(&user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+	return &user, nil
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/mail"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// appURL is where the frontend lives, for links in emails.
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	return "http://localhost:3000"
+}
+
+// sendMail delivers in the background so that response times do not tell
+// whether an account exists.
+func sendMail(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := mail.Outbox.Send(ctx, msg); err != nil {
+			log.Printf("Failed to send %q to %s: %v", msg.Subject, msg.To, err)
+		}
+	}()
+}
+
+// ForgotPassword emails a password reset link. The response, and how long
+// it takes, is the same whether or not the email belongs to an account: the
+// lookup happens after the response.
+func ForgotPassword(c *fiber.Ctx) error {
+	type ForgotPasswordRequest struct {
+		Email string `json:"email" validate:"required,max=255"`
+	}
+
+	var req ForgotPasswordRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	go func(email string) {
+		if err := sendPasswordReset(email); err != nil {
+			log.Printf("Failed to issue a password reset: %v", err)
+		}
+	}(strings.TrimSpace(req.Email))
+
+	return c.JSON(fiber.Map{"message": "If that email has an account, a reset link has been sent"})
+}
+
+// sendPasswordReset emails a fresh reset link to the account with the
+// email, if there is one.
+func sendPasswordReset(email string) error {
+	var user models.User
+	if err := database.DB.Where("email = ?", email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	ttl := jobs.IntervalFromEnv("PASSWORD_RESET_TTL", time.Hour)
+	token := randomToken(32)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the latest link works
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := appURL() + "/reset-password?token=" + url.QueryEscape(token)
+	sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your SpendWise password",
+		Text: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your SpendWise account. To choose a new password, open:\n\n%s\n\n"+
+			"The link works once and expires in %s. If you did not ask for this, you can ignore this email.\n",
+			user.FullName, link, ttl),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword and
+// logs the user out everywhere.
+func ResetPassword(c *fiber.Ctx) error {
+	type ResetPasswordRequest struct {
+		Token       string `json:"token" validate:"required,max=100"`
+		NewPassword string `json:"new_password" validate:"required,password"`
+	}
+
+	var req ResetPasswordRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not hash password"})
+	}
+
+	var reset models.PasswordResetToken
+	if err := database.DB.Where("token_hash = ?", hashToken(req.Token)).First(&reset).Error; err != nil ||
+		reset.UsedAt != nil || time.Now().After(reset.ExpiresAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reset link is invalid or has expired"})
+	}
+
+	tx := database.DB.Begin()
+
+	claim := tx.Model(&models.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", reset.ID).
+		Update("used_at", time.Now())
+	if claim.Error != nil || claim.RowsAffected == 0 {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reset link is invalid or has expired"})
+	}
+
+	var user models.User
+	if err := tx.First(&user, reset.UserID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Reset link is invalid or has expired"})
+	}
+
+	if err := tx.Model(&user).Update("password_hash", string(hash)).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update password"})
+	}
+	if err := invalidateUserTokens(tx, &user); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update password"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{"message": "Password has been reset. Please log in with your new password."})
+}
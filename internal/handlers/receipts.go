@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"log"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// queueReceipt hands an attachment to the receipt job. Clients poll
+// GetAttachmentExtraction for the result. It returns nil when OCR is
+// disabled.
+func queueReceipt(attachment *models.ExpenseAttachment) *models.ReceiptExtraction {
+	extraction, err := jobs.QueueReceipt(attachment)
+	if err != nil {
+		log.Printf("Could not queue receipt extraction for attachment %d: %v", attachment.ID, err)
+		return nil
+	}
+	return extraction
+}
+
+// receiptSuggestions maps an extraction onto CreateExpense fields.
+func receiptSuggestions(ex *models.ReceiptExtraction) fiber.Map {
+	if ex == nil || ex.Status != "completed" {
+		return nil
+	}
+	suggestions := fiber.Map{"confidence": ex.Confidence}
+	if ex.Merchant != "" {
+		suggestions["title"] = ex.Merchant
+	}
+	if ex.Total != nil {
+		suggestions["amount"] = *ex.Total
+	}
+	if ex.Tax != nil {
+		suggestions["tax"] = *ex.Tax
+	}
+	if ex.ReceiptDate != nil {
+		suggestions["date"] = ex.ReceiptDate.Format("2006-01-02")
+	}
+	return suggestions
+}
+
+// loadAttachmentForMember fetches an attachment if the user belongs to the
+// group of the expense it is attached to.
+func loadAttachmentForMember(attachmentID string, userID uint) (*models.ExpenseAttachment, *models.ExpenseRequest, error) {
+	var attachment models.ExpenseAttachment
+	if err := database.DB.Preload("Extraction").First(&attachment, attachmentID).Error; err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusNotFound, "Attachment not found")
+	}
+
+	var expense models.ExpenseRequest
+	if err := database.DB.First(&expense, attachment.ExpenseID).Error; err != nil {
+		return nil, nil, fiber.NewError(fiber.StatusNotFound, "Expense not found")
+	}
+
+	var memberCount int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", expense.GroupID, userID).Count(&memberCount)
+	if memberCount == 0 {
+		return nil, nil, fiber.NewError(fiber.StatusForbidden, "Not a member of this group")
+	}
+	return &attachment, &expense, nil
+}
+
+func GetAttachmentExtraction(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	attachment, _, err := loadAttachmentForMember(c.Params("id"), userID)
+	if err != nil {
+		e := err.(*fiber.Error)
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+	if attachment.Extraction == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "No extraction for this attachment"})
+	}
+
+	return c.JSON(fiber.Map{
+		"extraction":  attachment.Extraction,
+		"suggestions": receiptSuggestions(attachment.Extraction),
+	})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func CreateRecurringExpense(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	type CreateRecurringRequest struct {
+		GroupID        uint       `json:"group_id" validate:"required"`
+		Title          string     `json:"title" validate:"required,max=200"`
+		Category       string     `json:"category" validate:"max=100"`
+		CategoryID     *uint      `json:"category_id"`
+		Amount         float64    `json:"amount" validate:"required,gt=0"`
+		Description    string     `json:"description" validate:"max=2000"`
+		TargetUserID   *uint      `json:"target_user_id"`
+		IsDirectRecord bool       `json:"is_direct_record"`
+		Frequency      string     `json:"frequency"`
+		DayOfMonth     int        `json:"day_of_month"`
+		Weekday        int        `json:"weekday"`
+		Hour           int        `json:"hour"`
+		Minute         int        `json:"minute"`
+		CronExpr       string     `json:"cron_expr" validate:"max=100"`
+		StartsAt       *time.Time `json:"starts_at"`
+		EndsAt         *time.Time `json:"ends_at"`
+	}
+
+	var req CreateRecurringRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", req.GroupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	if req.TargetUserID != nil && activeMemberCount(req.GroupID, []uint{*req.TargetUserID}) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The approver must be a member of this group"})
+	}
+
+	category, msg := resolveCategory(req.GroupID, req.CategoryID, req.Category)
+	if msg != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+	}
+	var categoryID *uint
+	if category != nil {
+		categoryID = &category.ID
+		req.Category = category.Name
+	}
+
+	startsAt := time.Now()
+	if req.StartsAt != nil {
+		startsAt = *req.StartsAt
+	}
+	if req.EndsAt != nil && req.EndsAt.Before(startsAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ends_at must be after starts_at"})
+	}
+
+	recurring := models.RecurringExpense{
+		GroupID:        req.GroupID,
+		RequesterID:    userID,
+		Title:          req.Title,
+		Category:       req.Category,
+		CategoryID:     categoryID,
+		Amount:         req.Amount,
+		Description:    req.Description,
+		TargetUserID:   req.TargetUserID,
+		IsDirectRecord: req.IsDirectRecord,
+		Frequency:      req.Frequency,
+		DayOfMonth:     req.DayOfMonth,
+		Weekday:        req.Weekday,
+		Hour:           req.Hour,
+		Minute:         req.Minute,
+		CronExpr:       req.CronExpr,
+		StartsAt:       startsAt,
+		EndsAt:         req.EndsAt,
+		IsActive:       true,
+	}
+
+	nextRun, err := jobs.FirstRun(&recurring)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule: " + err.Error()})
+	}
+	recurring.NextRunAt = nextRun
+
+	if err := database.DB.Create(&recurring).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create recurring expense"})
+	}
+
+	return c.JSON(recurring)
+}
+
+func ListRecurringExpenses(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.QueryInt("group_id", 0)
+
+	query := database.DB.Model(&models.RecurringExpense{})
+	if groupID > 0 {
+		// Verify membership
+		var memberCount int64
+		database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&memberCount)
+		if memberCount == 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+		}
+		query = query.Where("group_id = ?", groupID)
+	} else {
+		query = query.Where("requester_id = ?", userID)
+	}
+
+	recurring := make([]models.RecurringExpense, 0)
+	if err := query.Order("created_at desc").Find(&recurring).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch recurring expenses"})
+	}
+
+	return c.JSON(recurring)
+}
+
+func UpdateRecurringExpense(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	id := c.Params("id")
+
+	type UpdateRecurringRequest struct {
+		Title       *string    `json:"title" validate:"notblank,max=200"`
+		Amount      *float64   `json:"amount" validate:"gt=0"`
+		Description *string    `json:"description" validate:"max=2000"`
+		EndsAt      *time.Time `json:"ends_at"`
+		IsActive    *bool      `json:"is_active"`
+	}
+
+	var req UpdateRecurringRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var recurring models.RecurringExpense
+	if err := database.DB.Where("id = ? AND requester_id = ?", id, userID).First(&recurring).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Recurring expense not found"})
+	}
+
+	if req.Title != nil {
+		recurring.Title = *req.Title
+	}
+	if req.Amount != nil {
+		if *req.Amount <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Amount must be positive"})
+		}
+		recurring.Amount = *req.Amount
+	}
+	if req.Description != nil {
+		recurring.Description = *req.Description
+	}
+	if req.EndsAt != nil {
+		recurring.EndsAt = req.EndsAt
+		if recurring.NextRunAt != nil && recurring.NextRunAt.After(*req.EndsAt) {
+			recurring.NextRunAt = nil
+		}
+	}
+	if req.IsActive != nil {
+		if *req.IsActive && !recurring.IsActive {
+			nextRun, err := jobs.NextRunAfter(&recurring, time.Now())
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid schedule: " + err.Error()})
+			}
+			recurring.NextRunAt = nextRun
+		}
+		recurring.IsActive = *req.IsActive
+	}
+
+	if err := database.DB.Save(&recurring).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update recurring expense"})
+	}
+
+	return c.JSON(recurring)
+}
+
+func DeleteRecurringExpense(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	id := c.Params("id")
+
+	// Generated expenses keep their recurring_id for history
+	result := database.DB.Where("id = ? AND requester_id = ?", id, userID).Delete(&models.RecurringExpense{})
+	if result.Error != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not delete recurring expense"})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Recurring expense not found"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Recurring expense deleted successfully"})
+}
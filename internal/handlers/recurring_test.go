@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReactivateRecurringExpense(t *testing.T) {
+	setupTestDB()
+	app := setupApp()
+	app.Put("/recurring-expenses/:id", asTestUser, UpdateRecurringExpense)
+
+	user := createTestUser("recurring@example.com", false)
+	group := createTestGroup("recurring", false, user, map[uint]string{user.ID: "admin"})
+
+	// Paused three months ago, with its next run long gone
+	missed := time.Now().AddDate(0, -3, 0)
+	recurring := models.RecurringExpense{
+		GroupID:     group.ID,
+		RequesterID: user.ID,
+		Title:       "Rent",
+		Amount:      500,
+		Frequency:   "monthly",
+		DayOfMonth:  1,
+		StartsAt:    time.Now().AddDate(-1, 0, 0),
+		NextRunAt:   &missed,
+		IsActive:    true,
+	}
+	database.DB.Create(&recurring)
+	database.DB.Model(&recurring).Update("is_active", false)
+
+	status, data := sendAs(t, app, "PUT", fmt.Sprintf("/recurring-expenses/%d", recurring.ID), user.ID, strings.NewReader(`{"is_active": true}`))
+	assert.Equal(t, 200, status)
+
+	var body models.RecurringExpense
+	json.Unmarshal(data, &body)
+	assert.True(t, body.IsActive)
+	if assert.NotNil(t, body.NextRunAt) {
+		assert.True(t, body.NextRunAt.After(time.Now()), "next run should be in the future, got %v", body.NextRunAt)
+	}
+
+	// The months spent paused are not made up for
+	assert.NoError(t, jobs.GenerateRecurringExpenses())
+	var generated int64
+	database.DB.Model(&models.ExpenseRequest{}).Where("recurring_id = ?", recurring.ID).Count(&generated)
+	assert.Equal(t, int64(0), generated)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"errors"
+
+	"spendwise-backend/internal/validation"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var errInvalidBody = errors.New("invalid request body")
+
+// parseBody parses the request body into req, lets it normalize itself and
+// checks its validate tags. An empty body leaves req as it is.
+func parseBody(c *fiber.Ctx, req interface{}) error {
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(req); err != nil {
+			return errInvalidBody
+		}
+	}
+	if n, ok := req.(validation.Normalizer); ok {
+		n.Normalize()
+	}
+	return validation.Struct(req)
+}
+
+// badRequest answers a parseBody error, listing what is wrong per field
+// when validation failed.
+func badRequest(c *fiber.Ctx, err error) error {
+	var fields validation.Errors
+	if errors.As(err, &fields) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":  "Invalid input: " + fields.Error(),
+			"fields": fields,
+		})
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// describeDevice makes a readable name such as "Chrome on Windows" out of a
+// user agent, for sessions whose client did not name itself.
+func describeDevice(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"},
+		{"opr/", "Opera"},
+		{"firefox/", "Firefox"},
+		{"chrome/", "Chrome"},
+		{"safari/", "Safari"},
+		{"okhttp", "Android app"},
+		{"cfnetwork", "iOS app"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	platform := ""
+	for _, p := range []struct{ token, name string }{
+		{"iphone", "iPhone"},
+		{"ipad", "iPad"},
+		{"android", "Android"},
+		{"windows", "Windows"},
+		{"mac os", "macOS"},
+		{"linux", "Linux"},
+	} {
+		if strings.Contains(ua, p.token) {
+			platform = p.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && platform != "":
+		return browser + " on " + platform
+	case browser != "":
+		return browser
+	case platform != "":
+		return platform
+	default:
+		return truncate(userAgent, 100)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// ListSessions shows where the user is logged in, most recently used first.
+func ListSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	sessionID, _ := c.Locals("session_id").(uint)
+
+	var sessions []models.Session
+	if err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch sessions"})
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == sessionID
+	}
+
+	return c.JSON(sessions)
+}
+
+// RevokeSession logs the user out on one device, possibly this one.
+func RevokeSession(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid session ID"})
+	}
+
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userID).First(&session).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Session not found"})
+	}
+
+	if err := revokeSessions(database.DB, "id = ?", session.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke session"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions logs the user out everywhere except this session.
+func RevokeOtherSessions(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	sessionID, _ := c.Locals("session_id").(uint)
+
+	if err := revokeSessions(database.DB, "user_id = ? AND id <> ?", userID, sessionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke sessions"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Other sessions revoked"})
+}
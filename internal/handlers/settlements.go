@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/split"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GetSettleUp returns each member's outstanding balance and the shortest
+// list of transfers that would settle the group.
+func GetSettleUp(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	balances, err := groupBalances(member.GroupID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not calculate balances"})
+	}
+
+	nets := make(map[uint]float64)
+	result := make([]map[string]interface{}, 0)
+	for id, b := range balances {
+		nets[id] = b.Net()
+		result = append(result, map[string]interface{}{
+			"user_id":  id,
+			"owes":     b.Owes,
+			"is_owed":  b.IsOwed,
+			"paid":     b.Paid,
+			"received": b.Received,
+			"net":      b.Net(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"balances":  result,
+		"transfers": split.Simplify(nets),
+	})
+}
+
+// CreateSettlement records the caller paying another member. Both wallets
+// are updated with linked transactions, and once every balance in the group
+// is back to zero the outstanding debts are marked as cleared.
+func CreateSettlement(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid group id"})
+	}
+
+	type SettlementRequest struct {
+		ToUserID uint    `json:"to_user_id" validate:"required"`
+		Amount   float64 `json:"amount" validate:"required,gt=0"`
+		Note     string  `json:"note" validate:"max=500"`
+	}
+
+	var req SettlementRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+	if req.ToUserID == userID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot settle with yourself"})
+	}
+
+	// Both sides must be members
+	var memberCount int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id IN ?", groupID, []uint{userID, req.ToUserID}).Count(&memberCount)
+	if memberCount < 2 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Both users must be members of this group"})
+	}
+
+	// Don't let anyone pay more than is actually outstanding
+	balances, err := groupBalances(uint(groupID))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not calculate balances"})
+	}
+	var payerNet, receiverNet float64
+	if b := balances[userID]; b != nil {
+		payerNet = b.Net()
+	}
+	if b := balances[req.ToUserID]; b != nil {
+		receiverNet = b.Net()
+	}
+	if outstanding := math.Min(-payerNet, receiverNet); req.Amount > outstanding+0.005 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": fmt.Sprintf("Amount exceeds the outstanding balance of %.2f", math.Max(outstanding, 0))})
+	}
+
+	var payer, receiver models.User
+	if err := database.DB.First(&payer, userID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err := database.DB.First(&receiver, req.ToUserID).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	now := time.Now()
+	settlement := models.Settlement{
+		GroupID:    uint(groupID),
+		FromUserID: userID,
+		ToUserID:   req.ToUserID,
+		Amount:     req.Amount,
+		Note:       req.Note,
+		CreatedAt:  now,
+	}
+
+	tx := database.DB.Begin()
+
+	if err := tx.Create(&settlement).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not record settlement"})
+	}
+
+	if err := tx.Model(&payer).Update("wallet_balance", gorm.Expr("wallet_balance - ?", req.Amount)).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update wallet balance"})
+	}
+	if err := tx.Model(&receiver).Update("wallet_balance", gorm.Expr("wallet_balance + ?", req.Amount)).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update wallet balance"})
+	}
+
+	transactions := []models.WalletTransaction{
+		{
+			UserID:       userID,
+			Amount:       req.Amount,
+			Type:         "debit",
+			Description:  fmt.Sprintf("Settle up with %s", receiver.FullName),
+			ReferenceID:  settlement.ID,
+			SettlementID: &settlement.ID,
+			CreatedAt:    now,
+		},
+		{
+			UserID:       req.ToUserID,
+			Amount:       req.Amount,
+			Type:         "credit",
+			Description:  fmt.Sprintf("Settle up from %s", payer.FullName),
+			ReferenceID:  settlement.ID,
+			SettlementID: &settlement.ID,
+			CreatedAt:    now,
+		},
+	}
+	if err := tx.Create(&transactions).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create transaction record"})
+	}
+
+	// If this settles the whole group, clear all outstanding debts
+	balances[userID] = ensureBalance(balances[userID])
+	balances[req.ToUserID] = ensureBalance(balances[req.ToUserID])
+	balances[userID].Paid += req.Amount
+	balances[req.ToUserID].Received += req.Amount
+
+	cleared := true
+	for _, b := range balances {
+		if math.Abs(b.Net()) >= 0.005 {
+			cleared = false
+			break
+		}
+	}
+	if cleared {
+		if err := tx.Model(&models.ExpenseSplit{}).
+			Where("cleared_at IS NULL AND expense_id IN (SELECT id FROM expense_requests WHERE group_id = ? AND status = ?)", groupID, "approved").
+			Update("cleared_at", now).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not clear debts"})
+		}
+		if err := tx.Model(&models.Settlement{}).
+			Where("group_id = ? AND cleared_at IS NULL", groupID).
+			Update("cleared_at", now).Error; err != nil {
+			tx.Rollback()
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not clear debts"})
+		}
+		settlement.ClearedAt = &now
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{
+		"settlement": settlement,
+		"cleared":    cleared,
+	})
+}
+
+func ensureBalance(b *memberBalance) *memberBalance {
+	if b == nil {
+		return &memberBalance{}
+	}
+	return b
+}
+
+func ListSettlements(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	groupID := c.Params("id")
+
+	// Verify membership
+	var member models.GroupMember
+	if err := database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&member).Error; err != nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Not a member of this group"})
+	}
+
+	settlements := make([]models.Settlement, 0)
+	if err := database.DB.Preload("FromUser").Preload("ToUser").
+		Where("group_id = ?", groupID).
+		Order("created_at desc").
+		Find(&settlements).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not fetch settlements"})
+	}
+
+	return c.JSON(settlements)
+}
@@ -1,11 +1,26 @@
 package handlers
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
 	"spendwise-backend/internal/database"
 	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/mail"
+	"spendwise-backend/internal/storage"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -58,7 +73,7 @@ func setupTestDB() {
 
 	// For now, let's just AutoMigrate. If we want fresh state, we should probably drop tables.
 	// Let's drop the specific tables we use.
-	testDB.Migrator().DropTable(&models.User{}, &models.ExpenseGroup{}, &models.GroupMember{}, &models.UserRole{}, &models.ExpenseRequest{}, &models.ExpenseAttachment{}, &models.ApprovalSlip{})
+	testDB.Migrator().DropTable(&models.User{}, &models.ExpenseGroup{}, &models.GroupMember{}, &models.UserRole{}, &models.ExpenseRequest{}, &models.ExpenseAttachment{}, &models.ApprovalSlip{}, &models.Session{}, &models.RefreshToken{}, &models.PasswordResetToken{}, &models.EmailVerificationToken{}, &models.RecoveryCode{}, &models.UserIdentity{}, &models.OIDCLoginState{}, &models.APIKey{}, &models.ExpenseSplit{}, &models.Settlement{}, &models.WalletTransaction{}, &models.RecurringExpense{}, &models.ApprovalDelegation{}, &models.ExpenseAuditLog{}, &models.Budget{}, &models.Category{}, &models.ExpenseTag{}, &models.CustomField{}, &models.ExpenseFieldValue{}, &models.ReceiptExtraction{})
 
 	// Migrate schema
 	err = testDB.AutoMigrate(
@@ -69,6 +84,26 @@ func setupTestDB() {
 		&models.ExpenseRequest{},
 		&models.ExpenseAttachment{},
 		&models.ApprovalSlip{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
+		&models.APIKey{},
+		&models.ExpenseSplit{},
+		&models.Settlement{},
+		&models.WalletTransaction{},
+		&models.RecurringExpense{},
+		&models.ApprovalDelegation{},
+		&models.ExpenseAuditLog{},
+		&models.Budget{},
+		&models.Category{},
+		&models.ExpenseTag{},
+		&models.CustomField{},
+		&models.ExpenseFieldValue{},
+		&models.ReceiptExtraction{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate test database:", err)
@@ -78,6 +113,87 @@ func setupTestDB() {
 }
 
 func setupApp() *fiber.App {
+	storage.Files = storage.NewLocal(filepath.Join(os.TempDir(), "spendwise-test-uploads"))
+	mail.Outbox = &mail.Memory{}
 	app := fiber.New()
 	return app
 }
+
+// asTestUser stands in for middleware.Protected, taking the caller from the
+// X-Test-User header instead of a token.
+func asTestUser(c *fiber.Ctx) error {
+	var id uint
+	fmt.Sscan(c.Get("X-Test-User"), &id)
+	c.Locals("user_id", id)
+	return c.Next()
+}
+
+// sendAs makes a request as the given user to routes behind asTestUser.
+// JSON is assumed unless a content type is given.
+func sendAs(t *testing.T, app *fiber.App, method, path string, userID uint, body io.Reader, contentType ...string) (int, []byte) {
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType[0])
+	}
+	req.Header.Set("X-Test-User", fmt.Sprint(userID))
+	return send(t, app, req)
+}
+
+// sendWithToken makes a JSON request to public routes or routes behind
+// middleware.Protected, passing the access token or API key if one is given.
+// A nil payload sends no body.
+func sendWithToken(t *testing.T, app *fiber.App, method, path, token string, payload interface{}) (int, []byte) {
+	var body io.Reader
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, body)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return send(t, app, req)
+}
+
+func send(t *testing.T, app *fiber.App, req *http.Request) (int, []byte) {
+	resp, err := app.Test(req)
+	if !assert.NoError(t, err) {
+		return 0, nil
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+// signupAndLogin registers a user through the API and returns the login
+// response. The app needs the Signup and Login routes.
+func signupAndLogin(t *testing.T, app *fiber.App, email, password, fullName string) map[string]interface{} {
+	sendWithToken(t, app, "POST", "/auth/signup", "", map[string]string{"email": email, "password": password, "full_name": fullName})
+	_, body := sendWithToken(t, app, "POST", "/auth/login", "", map[string]string{"email": email, "password": password})
+	var login map[string]interface{}
+	json.Unmarshal(body, &login)
+	return login
+}
+
+func createTestUser(email string, twoFactor bool) models.User {
+	user := models.User{Email: email, PasswordHash: "-", FullName: strings.Split(email, "@")[0]}
+	if twoFactor {
+		now := time.Now()
+		user.TOTPEnabledAt = &now
+	}
+	database.DB.Create(&user)
+	return user
+}
+
+// createTestGroup creates a group owned by creator, with creator and the
+// other members holding the given roles.
+func createTestGroup(name string, requireTwoFactor bool, creator models.User, roles map[uint]string) models.ExpenseGroup {
+	group := models.ExpenseGroup{Name: name, InviteCode: name + "-invite", CreatedBy: creator.ID, RequireTwoFactor: requireTwoFactor}
+	database.DB.Create(&group)
+	for userID, role := range roles {
+		database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: userID, JoinedAt: time.Now()})
+		database.DB.Create(&models.UserRole{GroupID: group.ID, UserID: userID, Role: role})
+	}
+	return group
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/split"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+type SplitRequest struct {
+	Method       string              `json:"method" validate:"oneof=equal exact percent shares"`
+	Participants []split.Participant `json:"participants"`
+}
+
+// buildSplits validates a split against the group's members and works out
+// each participant's share of total.
+func buildSplits(groupID uint, total float64, req *SplitRequest) ([]models.ExpenseSplit, string) {
+	userIDs := make([]uint, 0, len(req.Participants))
+	seen := make(map[uint]bool, len(req.Participants))
+	for _, p := range req.Participants {
+		if seen[p.UserID] {
+			return nil, "Each split participant can only be listed once"
+		}
+		seen[p.UserID] = true
+		userIDs = append(userIDs, p.UserID)
+	}
+
+	if int(activeMemberCount(groupID, userIDs)) != len(userIDs) {
+		return nil, "All split participants must be members of this group"
+	}
+
+	amounts, err := split.Compute(total, req.Method, req.Participants)
+	if err != nil {
+		return nil, "Invalid split: " + err.Error()
+	}
+
+	splits := make([]models.ExpenseSplit, len(amounts))
+	for i, p := range req.Participants {
+		splits[i] = models.ExpenseSplit{
+			UserID:  p.UserID,
+			Amount:  amounts[i],
+			Percent: p.Percent,
+			Shares:  p.Shares,
+		}
+	}
+	return splits, ""
+}
+
+func saveSplits(tx *gorm.DB, expenseID uint, splits []models.ExpenseSplit) error {
+	for i := range splits {
+		splits[i].ExpenseID = expenseID
+		if err := tx.Create(&splits[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type memberBalance struct {
+	Owes     float64 `json:"owes"`
+	IsOwed   float64 `json:"is_owed"`
+	Paid     float64 `json:"paid"`     // Settlements sent
+	Received float64 `json:"received"` // Settlements received
+}
+
+// Net is positive when the member is owed money and negative when they owe.
+func (b *memberBalance) Net() float64 {
+	return b.IsOwed - b.Owes + b.Paid - b.Received
+}
+
+// groupBalances totals who owes whom across the group's approved split
+// expenses and settlements that have not been cleared yet. The payer of an
+// expense is whoever's wallet was debited, i.e. the approver.
+func groupBalances(groupID uint) (map[uint]*memberBalance, error) {
+	type row struct {
+		PayerID uint
+		UserID  uint
+		Amount  float64
+	}
+
+	var rows []row
+	if err := database.DB.Table("expense_splits").
+		Select("COALESCE(expense_requests.approved_by, expense_requests.requester_id) AS payer_id, expense_splits.user_id, expense_splits.amount").
+		Joins("JOIN expense_requests ON expense_requests.id = expense_splits.expense_id").
+		Where("expense_requests.group_id = ? AND expense_requests.status = ?", groupID, "approved").
+		Where("expense_splits.cleared_at IS NULL").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var settlements []models.Settlement
+	if err := database.DB.Where("group_id = ? AND cleared_at IS NULL", groupID).Find(&settlements).Error; err != nil {
+		return nil, err
+	}
+
+	balances := make(map[uint]*memberBalance)
+	get := func(id uint) *memberBalance {
+		if balances[id] == nil {
+			balances[id] = &memberBalance{}
+		}
+		return balances[id]
+	}
+	for _, r := range rows {
+		if r.PayerID == r.UserID {
+			continue // Own share of something you paid for
+		}
+		get(r.UserID).Owes += r.Amount
+		get(r.PayerID).IsOwed += r.Amount
+	}
+	for _, st := range settlements {
+		get(st.FromUserID).Paid += st.Amount
+		get(st.ToUserID).Received += st.Amount
+	}
+	return balances, nil
+}
+
+// UpdateExpenseSplit replaces the split of a pending expense.
+func UpdateExpenseSplit(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	expenseID := c.Params("id")
+
+	var req SplitRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var expense models.ExpenseRequest
+	if err := database.DB.Where("id = ? AND requester_id = ?", expenseID, userID).First(&expense).Error; err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Expense not found"})
+	}
+	if expense.Status != "pending" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Only pending expenses can be re-split"})
+	}
+
+	var splits []models.ExpenseSplit
+	if len(req.Participants) > 0 {
+		var msg string
+		if splits, msg = buildSplits(expense.GroupID, expense.Amount, &req); msg != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": msg})
+		}
+	} else {
+		// No participants removes the split
+		req.Method = ""
+	}
+
+	tx := database.DB.Begin()
+
+	if err := tx.Where("expense_id = ?", expense.ID).Delete(&models.ExpenseSplit{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update split"})
+	}
+	if err := saveSplits(tx, expense.ID, splits); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update split"})
+	}
+	expense.SplitMethod = req.Method
+	expense.UpdatedAt = time.Now()
+	if err := tx.Save(&expense).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not update split"})
+	}
+
+	tx.Commit()
+
+	expense.Splits = splits
+	return c.JSON(expense)
+}
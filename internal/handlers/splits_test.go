@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"testing"
+
+	"spendwise-backend/internal/services/split"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSplits(t *testing.T) {
+	setupTestDB()
+
+	payer := createTestUser("split-payer@example.com", false)
+	friend := createTestUser("split-friend@example.com", false)
+	outsider := createTestUser("split-outsider@example.com", false)
+	group := createTestGroup("split", false, payer, map[uint]string{
+		payer.ID:  "admin",
+		friend.ID: "requester",
+	})
+
+	t.Run("Equal", func(t *testing.T) {
+		splits, msg := buildSplits(group.ID, 30, &SplitRequest{Method: "equal", Participants: []split.Participant{{UserID: payer.ID}, {UserID: friend.ID}}})
+		assert.Empty(t, msg)
+		if assert.Len(t, splits, 2) {
+			assert.Equal(t, float64(15), splits[0].Amount)
+			assert.Equal(t, float64(15), splits[1].Amount)
+		}
+	})
+
+	t.Run("Duplicate Participant", func(t *testing.T) {
+		_, msg := buildSplits(group.ID, 30, &SplitRequest{Method: "equal", Participants: []split.Participant{{UserID: friend.ID}, {UserID: friend.ID}}})
+		assert.Equal(t, "Each split participant can only be listed once", msg)
+	})
+
+	t.Run("Not A Member", func(t *testing.T) {
+		_, msg := buildSplits(group.ID, 30, &SplitRequest{Method: "equal", Participants: []split.Participant{{UserID: payer.ID}, {UserID: outsider.ID}}})
+		assert.Equal(t, "All split participants must be members of this group", msg)
+	})
+}
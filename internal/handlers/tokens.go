@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/jobs"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// randomToken returns n random bytes, URL-safe encoded.
+func randomToken(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// hashToken is how opaque tokens are stored, so a database leak does not
+// leak usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAccessToken issues a short-lived JWT for a session. "ver" must match
+// the user's token version and the session must not be revoked for
+// middleware.Protected to accept it.
+func signAccessToken(user *models.User, session *models.Session) (string, time.Time, error) {
+	expiresAt := time.Now().Add(jobs.IntervalFromEnv("ACCESS_TOKEN_TTL", 15*time.Minute))
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID,
+		"sid":     session.ID,
+		"ver":     user.TokenVersion,
+		"iat":     time.Now().Unix(),
+		"exp":     expiresAt.Unix(),
+	})
+
+	signed, err := token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	return signed, expiresAt, err
+}
+
+func refreshTokenTTL() time.Duration {
+	return jobs.IntervalFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// startSession records a new login from the device making the request.
+func startSession(tx *gorm.DB, c *fiber.Ctx, user *models.User, deviceName string) (*models.Session, error) {
+	userAgent := c.Get(fiber.HeaderUserAgent)
+	if deviceName == "" {
+		deviceName = describeDevice(userAgent)
+	}
+
+	session := models.Session{
+		UserID:     user.ID,
+		DeviceName: truncate(deviceName, 100),
+		UserAgent:  truncate(userAgent, 500),
+		IPAddress:  c.IP(),
+		LastSeenAt: time.Now(),
+		ExpiresAt:  time.Now().Add(refreshTokenTTL()),
+	}
+	if err := tx.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// issueTokens creates an access token and a refresh token for a session.
+func issueTokens(tx *gorm.DB, user *models.User, session *models.Session) (fiber.Map, error) {
+	accessToken, expiresAt, err := signAccessToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := randomToken(32)
+	record := models.RefreshToken{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(refreshTokenTTL()),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return fiber.Map{
+		"token":              accessToken,
+		"expires_at":         expiresAt,
+		"refresh_token":      refreshToken,
+		"refresh_expires_at": record.ExpiresAt,
+		"session_id":         session.ID,
+	}, nil
+}
+
+// newLogin starts a session for a user whose credentials have been checked
+// and returns its tokens.
+func newLogin(c *fiber.Ctx, user *models.User, deviceName string) (fiber.Map, *fiber.Error) {
+	tx := database.DB.Begin()
+
+	session, err := startSession(tx, c, user, deviceName)
+	if err != nil {
+		tx.Rollback()
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Could not start session")
+	}
+	tokens, err := issueTokens(tx, user, session)
+	if err != nil {
+		tx.Rollback()
+		return nil, fiber.NewError(fiber.StatusInternalServerError, "Could not generate token")
+	}
+
+	tx.Commit()
+
+	tokens["user"] = user
+	return tokens, nil
+}
+
+// login responds with the tokens of a new session.
+func login(c *fiber.Ctx, user *models.User, deviceName string) error {
+	tokens, e := newLogin(c, user, deviceName)
+	if e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message})
+	}
+	return c.JSON(tokens)
+}
+
+// revokeSessions ends sessions along with their refresh tokens. Access
+// tokens of the sessions are rejected by middleware.Protected from then on.
+func revokeSessions(tx *gorm.DB, query string, args ...interface{}) error {
+	now := time.Now()
+
+	var ids []uint
+	if err := tx.Model(&models.Session{}).Where(query, args...).Where("revoked_at IS NULL").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).
+		Where("session_id IN ? AND revoked_at IS NULL", ids).
+		Update("revoked_at", now).Error
+}
+
+// invalidateUserTokens bumps the token version, which rejects every access
+// token issued so far, and revokes all sessions and API keys of the user.
+func invalidateUserTokens(tx *gorm.DB, user *models.User) error {
+	user.TokenVersion++
+	if err := tx.Model(user).Update("token_version", user.TokenVersion).Error; err != nil {
+		return err
+	}
+	if err := revokeSessions(tx, "user_id = ?", user.ID); err != nil {
+		return err
+	}
+	// A key minted by whoever got in would otherwise outlive the reset
+	return tx.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).Update("revoked_at", time.Now()).Error
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new
+// refresh token. Each refresh token works once.
+func RefreshToken(c *fiber.Ctx) error {
+	type RefreshRequest struct {
+		RefreshToken string `json:"refresh_token" validate:"required,max=100"`
+	}
+
+	var req RefreshRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var current models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", hashToken(req.RefreshToken)).First(&current).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+	if current.RevokedAt != nil || time.Now().After(current.ExpiresAt) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token has expired or been revoked"})
+	}
+
+	tx := database.DB.Begin()
+
+	// Claim the token; a second use means it was stolen or replayed
+	claim := tx.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", current.ID).
+		Update("used_at", time.Now())
+	if claim.Error != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not refresh token"})
+	}
+	if claim.RowsAffected == 0 {
+		tx.Rollback()
+		revokeSessions(database.DB, "id = ?", current.SessionID)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Refresh token was already used; please log in again"})
+	}
+
+	var session models.Session
+	if err := tx.Where("id = ? AND revoked_at IS NULL", current.SessionID).First(&session).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been revoked"})
+	}
+
+	var user models.User
+	if err := tx.First(&user, current.UserID).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+	}
+
+	session.LastSeenAt = time.Now()
+	session.ExpiresAt = time.Now().Add(refreshTokenTTL())
+	session.IPAddress = c.IP()
+	if err := tx.Model(&session).Updates(map[string]interface{}{
+		"last_seen_at": session.LastSeenAt,
+		"expires_at":   session.ExpiresAt,
+		"ip_address":   session.IPAddress,
+	}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not refresh token"})
+	}
+
+	tokens, err := issueTokens(tx, &user, &session)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not generate token"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(tokens)
+}
+
+// Logout revokes the session the refresh token belongs to, which also
+// invalidates its access tokens.
+func Logout(c *fiber.Ctx) error {
+	type LogoutRequest struct {
+		RefreshToken string `json:"refresh_token" validate:"required,max=100"`
+	}
+
+	var req LogoutRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var current models.RefreshToken
+	if err := database.DB.Where("token_hash = ?", hashToken(req.RefreshToken)).First(&current).Error; err == nil {
+		if err := revokeSessions(database.DB, "id = ?", current.SessionID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not log out"})
+		}
+	}
+
+	// Unknown tokens are logged out already
+	return c.JSON(fiber.Map{"message": "Logged out successfully"})
+}
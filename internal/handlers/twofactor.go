@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"os"
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/ratelimit"
+	"spendwise-backend/internal/services/totp"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// twoFactorChallengeTTL is how long a user has to enter their code after
+// the password was accepted.
+const twoFactorChallengeTTL = 5 * time.Minute
+
+func totpIssuer() string {
+	if issuer := os.Getenv("TOTP_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "SpendWise"
+}
+
+// signChallengeToken proves the password step of a login. It carries no
+// session, so middleware.Protected does not accept it.
+func signChallengeToken(user *models.User, deviceName string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": user.ID,
+		"purpose": "2fa",
+		"ver":     user.TokenVersion,
+		"device":  deviceName,
+		"exp":     time.Now().Add(twoFactorChallengeTTL).Unix(),
+	})
+	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+}
+
+func parseChallengeToken(tokenString string) (userID uint, version int, deviceName string, ok bool) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("JWT_SECRET")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return 0, 0, "", false
+	}
+
+	claims, _ := token.Claims.(jwt.MapClaims)
+	rawID, okID := claims["user_id"].(float64)
+	rawVersion, okVersion := claims["ver"].(float64)
+	if claims["purpose"] != "2fa" || !okID || !okVersion {
+		return 0, 0, "", false
+	}
+	deviceName, _ = claims["device"].(string)
+	return uint(rawID), int(rawVersion), deviceName, true
+}
+
+// newRecoveryCodes replaces the user's recovery codes and returns the new
+// ones; they are shown once.
+func newRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	encoding := base32.StdEncoding.WithPadding(base32.NoPadding)
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 7)
+		rand.Read(buf)
+		code := strings.ToLower(encoding.EncodeToString(buf))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: hashToken(codes[i])}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	if len(code) == 10 && !strings.Contains(code, "-") {
+		code = code[:5] + "-" + code[5:]
+	}
+	return code
+}
+
+// checkSecondFactor accepts a current TOTP code or an unused recovery code
+// and marks it as used.
+func checkSecondFactor(tx *gorm.DB, user *models.User, code, recoveryCode string) bool {
+	if code != "" {
+		secret, err := totp.Open(user.TOTPSecret)
+		if err != nil {
+			return false
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return false
+		}
+		// Two requests with the same code race here; only one wins
+		claim := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if claim.Error != nil || claim.RowsAffected == 0 {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	if recoveryCode != "" {
+		claim := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		return claim.Error == nil && claim.RowsAffected > 0
+	}
+
+	return false
+}
+
+// LoginTwoFactor completes a login that Login answered with a challenge.
+func LoginTwoFactor(c *fiber.Ctx) error {
+	type LoginTwoFactorRequest struct {
+		ChallengeToken string `json:"challenge_token" validate:"required,max=1000"`
+		Code           string `json:"code" validate:"max=10"`
+		RecoveryCode   string `json:"recovery_code" validate:"max=20"`
+	}
+
+	var req LoginTwoFactorRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	userID, version, deviceName, ok := parseChallengeToken(req.ChallengeToken)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Login challenge is invalid or has expired"})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || user.TokenVersion != version || user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Login challenge is invalid or has expired"})
+	}
+
+	// Guessing codes counts towards the same lockout as guessing passwords
+	lockout := ratelimit.DefaultLockout()
+	if wait, _ := lockout.Locked(c.Context(), user.Email); wait > 0 {
+		return tooManyAttempts(c, wait)
+	}
+	if !checkSecondFactor(database.DB, &user, req.Code, req.RecoveryCode) {
+		return failedLogin(c, lockout, user.Email, "Invalid authentication code")
+	}
+
+	lockout.Succeed(c.Context(), user.Email)
+	return login(c, &user, deviceName)
+}
+
+// EnrollTwoFactor creates a new secret for the user to add to their
+// authenticator app. 2FA is only switched on by ConfirmTwoFactor.
+func EnrollTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	var user models.User
+	if result := database.DB.First(&user, userID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+
+	secret := totp.GenerateSecret()
+	sealed, err := totp.Seal(secret)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create secret"})
+	}
+	if err := database.DB.Model(&user).Update("totp_secret", sealed).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create secret"})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(totpIssuer(), user.Email, secret),
+	})
+}
+
+// ConfirmTwoFactor turns 2FA on once the user shows a code from the
+// enrolled secret, and returns their recovery codes. Other sessions only
+// passed a password, so they are logged out.
+func ConfirmTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+	sessionID, _ := c.Locals("session_id").(uint)
+
+	type ConfirmTwoFactorRequest struct {
+		Code string `json:"code" validate:"required,max=10"`
+	}
+
+	var req ConfirmTwoFactorRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var user models.User
+	if result := database.DB.First(&user, userID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TOTPEnabledAt != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Two-factor authentication is already enabled"})
+	}
+	if user.TOTPSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Start enrolment first"})
+	}
+
+	tx := database.DB.Begin()
+
+	if !checkSecondFactor(tx, &user, req.Code, "") {
+		tx.Rollback()
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid authentication code"})
+	}
+
+	now := time.Now()
+	if err := tx.Model(&user).Update("totp_enabled_at", now).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not enable two-factor authentication"})
+	}
+	codes, err := newRecoveryCodes(tx, user.ID)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create recovery codes"})
+	}
+	if err := revokeSessions(tx, "user_id = ? AND id <> ?", user.ID, sessionID); err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not revoke sessions"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, e.g. after most were
+// used. A current code is required.
+func RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	type RegenerateRequest struct {
+		Code string `json:"code" validate:"required,max=10"`
+	}
+
+	var req RegenerateRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var user models.User
+	if result := database.DB.First(&user, userID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	}
+
+	tx := database.DB.Begin()
+
+	if !checkSecondFactor(tx, &user, req.Code, "") {
+		tx.Rollback()
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid authentication code"})
+	}
+	codes, err := newRecoveryCodes(tx, user.ID)
+	if err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not create recovery codes"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns 2FA off. It needs the password and a code (or a
+// recovery code), and is refused while a group requires 2FA of the user.
+func DisableTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	type DisableTwoFactorRequest struct {
+		Password     string `json:"password" validate:"required,max=200"`
+		Code         string `json:"code" validate:"max=10"`
+		RecoveryCode string `json:"recovery_code" validate:"max=20"`
+	}
+
+	var req DisableTwoFactorRequest
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+
+	var user models.User
+	if result := database.DB.First(&user, userID); result.Error != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+	}
+	if user.TOTPEnabledAt == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Two-factor authentication is not enabled"})
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid password"})
+	}
+
+	var requiring int64
+	database.DB.Model(&models.UserRole{}).
+		Joins("JOIN expense_groups ON expense_groups.id = user_roles.group_id").
+		Where("user_roles.user_id = ? AND user_roles.role IN ? AND expense_groups.require_two_factor", user.ID, twoFactorRoles).
+		Count(&requiring)
+	if requiring > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A group you approve for requires two-factor authentication"})
+	}
+
+	tx := database.DB.Begin()
+
+	if !checkSecondFactor(tx, &user, req.Code, req.RecoveryCode) {
+		tx.Rollback()
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid authentication code"})
+	}
+	if err := tx.Model(&user).Updates(map[string]interface{}{
+		"totp_secret":     "",
+		"totp_enabled_at": nil,
+		"totp_last_step":  0,
+	}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not disable two-factor authentication"})
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not disable two-factor authentication"})
+	}
+
+	tx.Commit()
+
+	return c.JSON(fiber.Map{"message": "Two-factor authentication disabled"})
+}
+
+// twoFactorRoles are the group roles a group's 2FA requirement applies to.
+var twoFactorRoles = []string{"approver", "admin"}
+
+func groupRequiresTwoFactor(groupID uint) bool {
+	var group models.ExpenseGroup
+	err := database.DB.Select("id", "require_two_factor").First(&group, groupID).Error
+	return err == nil && group.RequireTwoFactor
+}
+
+func userTwoFactorError(userID uint, message string) *fiber.Error {
+	var user models.User
+	if err := database.DB.Select("id", "totp_enabled_at").First(&user, userID).Error; err != nil || user.TOTPEnabledAt == nil {
+		return fiber.NewError(fiber.StatusForbidden, message)
+	}
+	return nil
+}
+
+// groupTwoFactorError returns a 403 when the group requires 2FA, the user
+// holds an approver or admin role in it and has not enabled 2FA.
+func groupTwoFactorError(userID, groupID uint) *fiber.Error {
+	if !groupRequiresTwoFactor(groupID) {
+		return nil
+	}
+
+	var privileged int64
+	database.DB.Model(&models.UserRole{}).
+		Where("group_id = ? AND user_id = ? AND role IN ?", groupID, userID, twoFactorRoles).
+		Count(&privileged)
+	if privileged == 0 {
+		return nil
+	}
+	return userTwoFactorError(userID, "This group requires two-factor authentication for approvers and admins")
+}
+
+// decisionTwoFactorError is groupTwoFactorError for approving and rejecting,
+// whatever the decider's role: requesters may decide untargeted expenses
+// and delegates decide for someone else.
+func decisionTwoFactorError(userID, groupID uint) *fiber.Error {
+	if !groupRequiresTwoFactor(groupID) {
+		return nil
+	}
+	return userTwoFactorError(userID, "This group requires two-factor authentication to approve or reject expenses")
+}
+
+// RequireGroupTwoFactor guards the group routes (":id") that change the
+// group, so approvers and admins cannot act in it without 2FA when the
+// group requires it.
+func RequireGroupTwoFactor(c *fiber.Ctx) error {
+	userID := c.Locals("user_id").(uint)
+
+	groupID, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Next()
+	}
+	if e := groupTwoFactorError(userID, uint(groupID)); e != nil {
+		return c.Status(e.Code).JSON(fiber.Map{"error": e.Message, "code": "two_factor_required"})
+	}
+	return c.Next()
+}
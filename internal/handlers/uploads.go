@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/storage"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// storedUpload is a file that went through the upload pipeline and is now
+// in the storage backend.
+type storedUpload struct {
+	Key         string
+	Name        string // Original filename, for display only
+	ContentType string // Sniffed, not the client's
+	Size        int64
+	SHA256      string
+	Variants    map[string]string // Variant name -> key, e.g. "thumb"
+	Reused      bool              // Objects belong to an identical earlier upload
+}
+
+// storeUpload validates and processes an uploaded file for its kind and
+// saves it with its variants under new opaque keys below prefix. Receipts
+// identical to one already attached in groupID share its objects; the
+// attachment must then be saved with claimUpload.
+func storeUpload(file *multipart.FileHeader, kind upload.Kind, prefix string, groupID uint) (*storedUpload, error) {
+	if policy, ok := upload.Policies[kind]; ok && file.Size > policy.MaxSize {
+		return nil, upload.ErrTooLarge
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	result, err := upload.Process(kind, src)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(result.Data)
+	hash := hex.EncodeToString(sum[:])
+
+	// Identical receipts in the same group share their stored objects
+	if kind == upload.Attachment && groupID != 0 {
+		var existing models.ExpenseAttachment
+		if err := database.DB.Joins("JOIN expense_requests ON expense_requests.id = expense_attachments.expense_id").
+			Where("expense_attachments.sha256 = ? AND expense_requests.group_id = ?", hash, groupID).
+			First(&existing).Error; err == nil {
+			stored := &storedUpload{
+				Key:         existing.FilePath,
+				Name:        cleanFileName(file.Filename),
+				ContentType: existing.FileType,
+				Size:        existing.FileSize,
+				SHA256:      hash,
+				Variants:    map[string]string{},
+				Reused:      true,
+			}
+			if existing.ThumbnailPath != "" {
+				stored.Variants["thumb"] = existing.ThumbnailPath
+			}
+			return stored, nil
+		}
+	}
+
+	ctx := context.Background()
+	key := storage.NewKey(prefix, result.Ext)
+	if err := storage.Files.Put(ctx, key, bytes.NewReader(result.Data), int64(len(result.Data)), result.ContentType); err != nil {
+		return nil, err
+	}
+
+	stored := &storedUpload{
+		Key:         key,
+		Name:        cleanFileName(file.Filename),
+		ContentType: result.ContentType,
+		Size:        int64(len(result.Data)),
+		SHA256:      hash,
+		Variants:    map[string]string{},
+	}
+	for name, variant := range result.Variants {
+		variantKey := storage.VariantKey(key, name, variant.Ext)
+		if err := storage.Files.Put(ctx, variantKey, bytes.NewReader(variant.Data), int64(len(variant.Data)), variant.ContentType); err != nil {
+			deleteUpload(stored)
+			return nil, err
+		}
+		stored.Variants[name] = variantKey
+	}
+	return stored, nil
+}
+
+// deleteUpload removes a stored upload and its variants, unless they are
+// shared with an earlier upload.
+func deleteUpload(stored *storedUpload) {
+	if stored.Reused {
+		return
+	}
+	ctx := context.Background()
+	storage.Files.Delete(ctx, stored.Key)
+	for _, key := range stored.Variants {
+		storage.Files.Delete(ctx, key)
+	}
+}
+
+// cleanFileName keeps the base name of a client filename, shortened to 255
+// bytes.
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" {
+		name = "file"
+	}
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
+
+// uploadError responds to a failed storeUpload.
+func uploadError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, upload.ErrTooLarge):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "File is too large"})
+	case errors.Is(err, upload.ErrUnsupportedType):
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{"error": "File type is not allowed"})
+	case errors.Is(err, upload.ErrInvalidImage):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Image could not be read"})
+	case errors.Is(err, errUploadReleased):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "The file was removed while uploading, please try again"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not save file"})
+}
+
+// ServeUpload serves avatars at /uploads/<key>. Attachments and slips
+// are only available through the authorized download routes.
+func ServeUpload(c *fiber.Ctx) error {
+	key := c.Params("*")
+	if !strings.HasPrefix(key, "avatars/") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "File not found"})
+	}
+
+	return sendStoredFile(c, key, path.Base(key), "")
+}
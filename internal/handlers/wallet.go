@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 func GetWallet(c *fiber.Ctx) error {
@@ -25,16 +26,12 @@ func TopupWallet(c *fiber.Ctx) error {
 	userID := c.Locals("user_id").(uint)
 
 	type TopupRequest struct {
-		Amount float64 `json:"amount"`
+		Amount float64 `json:"amount" validate:"required,gt=0"`
 	}
 
 	var req TopupRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid request body"})
-	}
-
-	if req.Amount <= 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Amount must be positive"})
+	if err := parseBody(c, &req); err != nil {
+		return badRequest(c, err)
 	}
 
 	var user models.User
@@ -44,10 +41,11 @@ func TopupWallet(c *fiber.Ctx) error {
 
 	tx := database.DB.Begin()
 
-	user.WalletBalance += req.Amount
-	user.UpdatedAt = time.Now()
-
-	if err := tx.Save(&user).Error; err != nil {
+	if err := tx.Model(&user).Update("wallet_balance", gorm.Expr("wallet_balance + ?", req.Amount)).Error; err != nil {
+		tx.Rollback()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not topup wallet"})
+	}
+	if err := tx.Select("wallet_balance").First(&user, userID).Error; err != nil {
 		tx.Rollback()
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not topup wallet"})
 	}
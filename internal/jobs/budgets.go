@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+)
+
+// budgetPeriod returns the budget window containing at, or false when a
+// custom budget does not cover that time.
+func budgetPeriod(b *models.Budget, at time.Time) (time.Time, time.Time, bool) {
+	year, month, _ := at.Date()
+	switch b.Period {
+	case "monthly":
+		start := time.Date(year, month, 1, 0, 0, 0, 0, at.Location())
+		return start, start.AddDate(0, 1, 0), true
+	case "quarterly":
+		firstMonth := month - (month-1)%3
+		start := time.Date(year, firstMonth, 1, 0, 0, 0, 0, at.Location())
+		return start, start.AddDate(0, 3, 0), true
+	case "custom":
+		if b.StartsAt == nil || b.EndsAt == nil || at.Before(*b.StartsAt) || !at.Before(*b.EndsAt) {
+			return time.Time{}, time.Time{}, false
+		}
+		return *b.StartsAt, *b.EndsAt, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// budgetSpent sums approved expenses counted against the budget in [start, end).
+func budgetSpent(b *models.Budget, start, end time.Time) float64 {
+	var spent float64
+	query := database.DB.Model(&models.ExpenseRequest{}).
+		Where("group_id = ? AND status = ?", b.GroupID, "approved").
+		Where("created_at >= ? AND created_at < ?", start, end)
+	if b.Category != "" {
+		query = query.Where("category = ?", b.Category)
+	}
+	query.Select("COALESCE(SUM(amount), 0)").Scan(&spent)
+	return spent
+}
+
+// BudgetStatus reports where a budget stands at the given time, with extra
+// added on top of what was already spent. It returns false when the budget
+// does not cover that time.
+func BudgetStatus(b *models.Budget, at time.Time, extra float64) (models.BudgetAlert, bool) {
+	start, end, ok := budgetPeriod(b, at)
+	if !ok {
+		return models.BudgetAlert{}, false
+	}
+
+	spent := budgetSpent(b, start, end)
+	alert := models.BudgetAlert{
+		BudgetID:    b.ID,
+		Name:        b.Name,
+		Category:    b.Category,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Limit:       b.Amount,
+		Spent:       spent,
+		Projected:   spent + extra,
+	}
+	if b.Amount > 0 {
+		alert.Percent = alert.Projected / b.Amount * 100
+	}
+
+	switch {
+	case alert.Projected > b.Amount:
+		alert.Level = "exceeded"
+		alert.Blocking = b.Enforcement == "block"
+	case alert.Percent >= b.WarnPercent:
+		alert.Level = "warning"
+	}
+	return alert, true
+}
+
+// CheckBudgets returns the alerts an expense would trigger if it were
+// approved now. Any alert with Blocking set should stop the action.
+func CheckBudgets(expense *models.ExpenseRequest) ([]models.BudgetAlert, bool) {
+	var budgets []models.Budget
+	database.DB.Where("group_id = ? AND (category = '' OR category = ?)", expense.GroupID, expense.Category).Find(&budgets)
+
+	at := expense.CreatedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	var alerts []models.BudgetAlert
+	blocked := false
+	for i := range budgets {
+		alert, ok := BudgetStatus(&budgets[i], at, expense.Amount)
+		if !ok || alert.Level == "" {
+			continue
+		}
+		alerts = append(alerts, alert)
+		if alert.Blocking {
+			blocked = true
+		}
+	}
+	return alerts, blocked
+}
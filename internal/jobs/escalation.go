@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+)
+
+// EscalateOverdueExpenses finds pending expenses that have outlived their
+// group's approval SLA and hands them to the group's fallback approver, or to
+// the group admins when no fallback is configured. Each expense is escalated
+// at most once.
+func EscalateOverdueExpenses() error {
+	var overdue []models.ExpenseRequest
+	err := database.DB.
+		Joins("JOIN expense_groups ON expense_groups.id = expense_requests.group_id").
+		Where("expense_requests.status = ? AND expense_requests.escalated_at IS NULL", "pending").
+		Where("expense_groups.approval_sla_hours > 0").
+		Where("expense_requests.created_at < NOW() - expense_groups.approval_sla_hours * interval '1 hour'").
+		Find(&overdue).Error
+	if err != nil {
+		return fmt.Errorf("find overdue expenses: %w", err)
+	}
+
+	for _, expense := range overdue {
+		if err := escalate(expense); err != nil {
+			log.Printf("Could not escalate expense %d: %v", expense.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func escalate(expense models.ExpenseRequest) error {
+	var group models.ExpenseGroup
+	if err := database.DB.First(&group, expense.GroupID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tx := database.DB.Begin()
+
+	// Guard on escalated_at so concurrent runs never escalate twice
+	result := tx.Model(&models.ExpenseRequest{}).
+		Where("id = ? AND status = ? AND escalated_at IS NULL", expense.ID, "pending").
+		Updates(map[string]interface{}{
+			"escalated_at":    now,
+			"escalated_to_id": group.FallbackApproverID,
+		})
+	if result.Error != nil {
+		tx.Rollback()
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	escalation := models.ExpenseEscalation{
+		ExpenseID:        expense.ID,
+		GroupID:          expense.GroupID,
+		PreviousTargetID: expense.TargetUserID,
+		EscalatedToID:    group.FallbackApproverID,
+		AgeHours:         now.Sub(expense.CreatedAt).Hours(),
+		SLAHours:         group.ApprovalSLAHours,
+		CreatedAt:        now,
+	}
+	if err := tx.Create(&escalation).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
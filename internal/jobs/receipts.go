@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/ocr"
+	"spendwise-backend/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ocrOnce   sync.Once
+	ocrEngine ocr.Engine
+)
+
+// ReceiptEngine picks the OCR engine on first use, after .env is loaded.
+func ReceiptEngine() ocr.Engine {
+	ocrOnce.Do(func() {
+		ocrEngine = ocr.Default()
+		if ocrEngine == nil {
+			log.Println("Receipt OCR disabled: no engine available")
+		}
+	})
+	return ocrEngine
+}
+
+// QueueReceipt records a pending extraction for an attachment, replacing any
+// earlier result, for ExtractPendingReceipts to pick up. It returns nil when
+// OCR is disabled.
+func QueueReceipt(attachment *models.ExpenseAttachment) (*models.ReceiptExtraction, error) {
+	engine := ReceiptEngine()
+	if engine == nil {
+		return nil, nil
+	}
+
+	extraction := models.ReceiptExtraction{
+		AttachmentID: attachment.ID,
+		ExpenseID:    attachment.ExpenseID,
+		Engine:       engine.Name(),
+		Status:       "pending",
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("attachment_id = ?", attachment.ID).Delete(&models.ReceiptExtraction{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&extraction).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &extraction, nil
+}
+
+// ExtractPendingReceipts runs OCR on queued receipts. Extractions left
+// processing by a run that died are retried once their timeout has long
+// passed.
+func ExtractPendingReceipts() error {
+	engine := ReceiptEngine()
+	if engine == nil {
+		return nil
+	}
+	timeout := IntervalFromEnv("OCR_TIMEOUT", 30*time.Second)
+
+	var queued []models.ReceiptExtraction
+	if err := database.DB.
+		Where("status = ? OR (status = ? AND started_at < ?)", "pending", "processing", time.Now().Add(-2*timeout)).
+		Order("id").Limit(20).
+		Find(&queued).Error; err != nil {
+		return fmt.Errorf("find queued receipts: %w", err)
+	}
+
+	for _, ex := range queued {
+		if err := extractReceipt(engine, ex, timeout); err != nil {
+			log.Printf("Receipt extraction %d failed: %v", ex.ID, err)
+		}
+	}
+	return nil
+}
+
+func extractReceipt(engine ocr.Engine, ex models.ReceiptExtraction, timeout time.Duration) error {
+	// Claim the extraction so concurrent instances do not read it twice.
+	// Postgres keeps microseconds, so truncate to compare against it later.
+	startedAt := time.Now().Truncate(time.Microsecond)
+	claim := database.DB.Model(&models.ReceiptExtraction{}).Where("id = ? AND status = ?", ex.ID, ex.Status)
+	if ex.StartedAt != nil {
+		claim = claim.Where("started_at = ?", *ex.StartedAt)
+	}
+	res := claim.Updates(map[string]interface{}{"status": "processing", "started_at": startedAt})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+
+	var attachment models.ExpenseAttachment
+	if err := database.DB.First(&attachment, ex.AttachmentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return database.DB.Delete(&ex).Error
+		}
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var receipt *ocr.Receipt
+	err := storage.WithLocalFile(ctx, storage.Files, attachment.FilePath, func(filePath string) error {
+		var err error
+		receipt, err = ocr.Extract(ctx, engine, filePath, attachment.FileType)
+		return err
+	})
+
+	ex.Engine = engine.Name()
+	ex.Status = "completed"
+	switch {
+	case errors.Is(err, ocr.ErrUnsupported):
+		ex.Status = "unsupported"
+	case err != nil:
+		ex.Status = "failed"
+		ex.Error = err.Error()
+	default:
+		ex.Merchant = receipt.Merchant
+		ex.Total = receipt.Total
+		ex.Tax = receipt.Tax
+		ex.ReceiptDate = receipt.Date
+		ex.Confidence = receipt.Confidence
+		ex.FieldConfidence = receipt.FieldConfidence
+		ex.RawText = receipt.Text
+	}
+
+	// The attachment may have been replaced or deleted while OCR ran, in
+	// which case the row is gone and nothing is saved
+	return database.DB.Model(&ex).
+		Where("status = ? AND started_at = ?", "processing", startedAt).
+		Select("*").Omit("id", "attachment_id", "expense_id", "created_at", "started_at").
+		Updates(&ex).Error
+}
@@ -0,0 +1,202 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/recurrence"
+
+	"gorm.io/gorm"
+)
+
+// ScheduleOf converts a recurring expense template into its schedule.
+func ScheduleOf(r *models.RecurringExpense) recurrence.Schedule {
+	return recurrence.Schedule{
+		Frequency:  r.Frequency,
+		DayOfMonth: r.DayOfMonth,
+		Weekday:    time.Weekday(r.Weekday),
+		Hour:       r.Hour,
+		Minute:     r.Minute,
+		CronExpr:   r.CronExpr,
+	}
+}
+
+// FirstRun returns the first occurrence at or after the template's start, or
+// nil if that already lies beyond its end date.
+func FirstRun(r *models.RecurringExpense) (*time.Time, error) {
+	first, err := ScheduleOf(r).Next(r.StartsAt.Add(-time.Minute))
+	if err != nil {
+		return nil, err
+	}
+	if first.Before(r.StartsAt) {
+		if first, err = ScheduleOf(r).Next(first); err != nil {
+			return nil, err
+		}
+	}
+	if r.EndsAt != nil && first.After(*r.EndsAt) {
+		return nil, nil
+	}
+	return &first, nil
+}
+
+// NextRunAfter returns the first occurrence after t, or nil if that lies
+// beyond the template's end date. Paused templates resume from here rather
+// than catching up on the runs they missed.
+func NextRunAfter(r *models.RecurringExpense, t time.Time) (*time.Time, error) {
+	if r.StartsAt.After(t) {
+		return FirstRun(r)
+	}
+	next, err := ScheduleOf(r).Next(t)
+	if err != nil {
+		return nil, err
+	}
+	if r.EndsAt != nil && next.After(*r.EndsAt) {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// GenerateRecurringExpenses creates the expenses for every template whose
+// next run is due, catching up on runs missed while the process was down.
+func GenerateRecurringExpenses() error {
+	now := time.Now()
+
+	var due []models.RecurringExpense
+	if err := database.DB.
+		Where("is_active = ? AND next_run_at IS NOT NULL AND next_run_at <= ?", true, now).
+		Find(&due).Error; err != nil {
+		return fmt.Errorf("find due recurring expenses: %w", err)
+	}
+
+	for _, r := range due {
+		if err := runRecurring(r, now); err != nil {
+			log.Printf("Recurring expense %d failed: %v", r.ID, err)
+		}
+	}
+
+	return nil
+}
+
+func runRecurring(r models.RecurringExpense, now time.Time) error {
+	// Templates of users who left the group stop generating
+	var memberCount int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", r.GroupID, r.RequesterID).Count(&memberCount)
+	if memberCount == 0 {
+		return database.DB.Model(&r).Update("is_active", false).Error
+	}
+
+	schedule := ScheduleOf(&r)
+	for r.NextRunAt != nil && !r.NextRunAt.After(now) {
+		occurrence := *r.NextRunAt
+
+		next, err := schedule.Next(occurrence)
+		if err != nil {
+			return err
+		}
+		nextRun := &next
+		if r.EndsAt != nil && next.After(*r.EndsAt) {
+			nextRun = nil
+		}
+
+		if err := generateOccurrence(&r, occurrence, nextRun); err != nil {
+			return err
+		}
+		r.NextRunAt = nextRun
+	}
+
+	return nil
+}
+
+// generateOccurrence claims one scheduled run and creates its expense in the
+// same transaction. The claim only succeeds while next_run_at still equals
+// the occurrence, so reruns after a restart (or a second instance) skip it.
+func generateOccurrence(r *models.RecurringExpense, occurrence time.Time, nextRun *time.Time) error {
+	tx := database.DB.Begin()
+
+	claim := tx.Model(&models.RecurringExpense{}).
+		Where("id = ? AND next_run_at = ?", r.ID, occurrence).
+		Updates(map[string]interface{}{
+			"next_run_at": nextRun,
+			"last_run_at": occurrence,
+		})
+	if claim.Error != nil {
+		tx.Rollback()
+		return claim.Error
+	}
+	if claim.RowsAffected == 0 {
+		tx.Rollback()
+		return nil
+	}
+
+	// Backstop for the unique (recurring_id, occurrence_at) index
+	var existing int64
+	tx.Model(&models.ExpenseRequest{}).Where("recurring_id = ? AND occurrence_at = ?", r.ID, occurrence).Count(&existing)
+	if existing > 0 {
+		return tx.Commit().Error
+	}
+
+	status := "pending"
+	var approvedBy *uint
+	var approvedAt *time.Time
+	if r.IsDirectRecord {
+		status = "approved"
+		approvedBy = &r.RequesterID
+		now := time.Now()
+		approvedAt = &now
+	}
+
+	expense := models.ExpenseRequest{
+		GroupID:      r.GroupID,
+		RequesterID:  r.RequesterID,
+		Title:        r.Title,
+		Category:     r.Category,
+		CategoryID:   r.CategoryID,
+		Amount:       r.Amount,
+		Description:  r.Description,
+		Status:       status,
+		TargetUserID: r.TargetUserID,
+		ApprovedBy:   approvedBy,
+		ApprovedAt:   approvedAt,
+		RecurringID:  &r.ID,
+		OccurrenceAt: &occurrence,
+	}
+
+	// Generated expenses obey the same budget limits as manual ones. A
+	// blocked run is skipped; later runs are tried again on schedule.
+	if _, blocked := CheckBudgets(&expense); blocked {
+		log.Printf("Recurring expense %d skipped its %s run: budget limit exceeded", r.ID, occurrence.Format(time.RFC3339))
+		return tx.Commit().Error
+	}
+
+	if err := tx.Create(&expense).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if r.IsDirectRecord {
+		// Deduct from Requester's Wallet
+		if err := tx.Model(&models.User{}).Where("id = ?", r.RequesterID).
+			Update("wallet_balance", gorm.Expr("wallet_balance - ?", r.Amount)).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		transaction := models.WalletTransaction{
+			UserID:      r.RequesterID,
+			Amount:      r.Amount,
+			Type:        "debit",
+			Description: fmt.Sprintf("Recurring expense: %s", r.Title),
+			ReferenceID: expense.ID,
+			CreatedAt:   time.Now(),
+		}
+		if err := tx.Create(&transaction).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
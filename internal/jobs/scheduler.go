@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// Every runs fn in the background once per interval for the lifetime of the
+// process. A failing run is logged and retried on the next tick.
+func Every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			run(name, fn)
+			<-ticker.C
+		}
+	}()
+	log.Printf("Scheduled job %q every %s", name, interval)
+}
+
+func run(name string, fn func() error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %q panicked: %v", name, r)
+		}
+	}()
+
+	if err := fn(); err != nil {
+		log.Printf("Job %q failed: %v", name, err)
+	}
+}
+
+// IntervalFromEnv reads a duration such as "15m" from the environment,
+// falling back to def when unset or invalid.
+func IntervalFromEnv(key string, def time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			return d
+		}
+		log.Printf("Invalid %s=%q, using %s", key, v, def)
+	}
+	return def
+}
@@ -0,0 +1,131 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/services/upload"
+	"spendwise-backend/internal/storage"
+)
+
+// UploadGCReport is the outcome of reconciling stored files against the
+// rows that reference them.
+type UploadGCReport struct {
+	Scanned int
+	Orphans []storage.Object // Unreferenced and older than the grace period
+	Recent  int              // Unreferenced but possibly still being saved
+	Deleted int
+	Failed  int
+}
+
+func (r *UploadGCReport) OrphanBytes() int64 {
+	var total int64
+	for _, obj := range r.Orphans {
+		total += obj.Size
+	}
+	return total
+}
+
+// referencedUploads collects every storage key used by attachments (and
+// their thumbnails), approval slips and avatars.
+func referencedUploads() (map[string]bool, error) {
+	refs := make(map[string]bool)
+
+	var attachments []models.ExpenseAttachment
+	if err := database.DB.Select("file_path", "thumbnail_path").Find(&attachments).Error; err != nil {
+		return nil, fmt.Errorf("load attachments: %w", err)
+	}
+	for _, a := range attachments {
+		refs[a.FilePath] = true
+		refs[a.ThumbnailPath] = true
+	}
+
+	var slips []models.ApprovalSlip
+	if err := database.DB.Select("file_path").Find(&slips).Error; err != nil {
+		return nil, fmt.Errorf("load slips: %w", err)
+	}
+	for _, s := range slips {
+		refs[s.FilePath] = true
+	}
+
+	var avatarURLs []string
+	if err := database.DB.Model(&models.User{}).Where("avatar_url <> ''").Pluck("avatar_url", &avatarURLs).Error; err != nil {
+		return nil, fmt.Errorf("load avatars: %w", err)
+	}
+	for _, url := range avatarURLs {
+		if key, ok := models.UploadKey(url); ok {
+			for _, k := range upload.AvatarKeys(key) {
+				refs[k] = true
+			}
+		}
+	}
+
+	return refs, nil
+}
+
+// CollectOrphanedUploads lists stored files that nothing references, e.g.
+// left behind by a failed insert or a replaced avatar, and deletes them if
+// remove is set. Files younger than grace are left alone since their rows
+// may not be committed yet. The storage location must not be shared with
+// anything else.
+func CollectOrphanedUploads(ctx context.Context, grace time.Duration, remove bool) (*UploadGCReport, error) {
+	// References are loaded first; anything referenced later is newer than
+	// the grace period
+	refs, err := referencedUploads()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &UploadGCReport{}
+	cutoff := time.Now().Add(-grace)
+	err = storage.Files.List(ctx, "", func(obj storage.Object) error {
+		report.Scanned++
+		if refs[obj.Key] {
+			return nil
+		}
+		if obj.ModTime.After(cutoff) {
+			report.Recent++
+			return nil
+		}
+		report.Orphans = append(report.Orphans, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list storage: %w", err)
+	}
+
+	if remove {
+		for _, obj := range report.Orphans {
+			if err := storage.Files.Delete(ctx, obj.Key); err != nil {
+				log.Printf("Could not delete orphaned upload %s: %v", obj.Key, err)
+				report.Failed++
+				continue
+			}
+			report.Deleted++
+		}
+	}
+
+	return report, nil
+}
+
+// CollectOrphanedUploadsJob is the scheduled form of CollectOrphanedUploads.
+// It only reports unless UPLOAD_GC_DELETE=true.
+func CollectOrphanedUploadsJob() error {
+	grace := IntervalFromEnv("UPLOAD_GC_GRACE", 24*time.Hour)
+	remove := os.Getenv("UPLOAD_GC_DELETE") == "true"
+
+	report, err := CollectOrphanedUploads(context.Background(), grace, remove)
+	if err != nil {
+		return err
+	}
+	if len(report.Orphans) > 0 {
+		log.Printf("Upload GC: %d of %d files orphaned (%d bytes), %d deleted, %d failed",
+			len(report.Orphans), report.Scanned, report.OrphanBytes(), report.Deleted, report.Failed)
+	}
+	return nil
+}
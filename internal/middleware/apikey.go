@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// apiKeyAuth authenticates a request made with an API key. An empty scope
+// means the route does not accept API keys.
+func apiKeyAuth(c *fiber.Ctx, key, scope string) error {
+	var apiKey models.APIKey
+	if err := database.DB.Where("key_hash = ?", models.HashAPIKey(key)).First(&apiKey).Error; err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid API key"})
+	}
+	now := time.Now()
+	if apiKey.RevokedAt != nil || (apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt)) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "API key has expired or been revoked"})
+	}
+
+	if scope == "" {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "API keys cannot be used for this endpoint"})
+	}
+	if !apiKey.HasScope(scope) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "API key is missing the " + scope + " scope"})
+	}
+
+	// Like session last-seen, last-used only needs to be roughly right
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		database.DB.Model(&apiKey).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": c.IP(),
+		})
+	}
+
+	c.Locals("user_id", apiKey.UserID)
+	c.Locals("api_key_id", apiKey.ID)
+	if apiKey.GroupID != nil {
+		c.Locals("api_key_group_id", *apiKey.GroupID)
+	}
+	return c.Next()
+}
@@ -3,12 +3,28 @@ package middleware
 import (
 	"os"
 	"strings"
+	"time"
+
+	"spendwise-backend/internal/database"
+	"spendwise-backend/internal/models"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func Protected() fiber.Handler {
+// APIKeyScopes maps HTTP methods to the API key scope they need.
+type APIKeyScopes map[string]string
+
+// Protected accepts session access tokens and, on routes given APIKeyScopes,
+// API keys holding the scope of the request method.
+func Protected(apiKeys ...APIKeyScopes) fiber.Handler {
+	scopes := APIKeyScopes{}
+	for _, s := range apiKeys {
+		for method, scope := range s {
+			scopes[method] = scope
+		}
+	}
+
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -16,18 +32,74 @@ func Protected() fiber.Handler {
 		}
 
 		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+		if strings.HasPrefix(tokenString, models.APIKeyPrefix) {
+			return apiKeyAuth(c, tokenString, scopes[c.Method()])
+		}
 		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
 		if err != nil || !token.Valid {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		userID := uint(claims["user_id"].(float64))
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+		}
+		rawID, okID := claims["user_id"].(float64)
+		rawSessionID, okSession := claims["sid"].(float64)
+		version, okVersion := claims["ver"].(float64)
+		if !okID || !okSession || !okVersion {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+		}
+		userID := uint(rawID)
+
+		// Tokens issued before a password change (or similar) are rejected
+		var user models.User
+		if err := database.DB.Select("id", "token_version").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+		}
+		if user.TokenVersion != int(version) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token has been revoked"})
+		}
+
+		sessionID := uint(rawSessionID)
+
+		var session models.Session
+		if err := database.DB.Select("id", "revoked_at", "last_seen_at").
+			Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil || session.RevokedAt != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Session has been revoked"})
+		}
+
+		// Last-seen only needs to be roughly right; skip most writes
+		if time.Since(session.LastSeenAt) > time.Minute {
+			database.DB.Model(&session).Updates(map[string]interface{}{
+				"last_seen_at": time.Now(),
+				"ip_address":   c.IP(),
+			})
+		}
 
 		c.Locals("user_id", userID)
+		c.Locals("session_id", sessionID)
+		return c.Next()
+	}
+}
+
+// Verified allows only users who confirmed their email address. It must run
+// after Protected.
+func Verified() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(uint)
+
+		var user models.User
+		if err := database.DB.Select("id", "verified_at").First(&user, userID).Error; err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "User not found"})
+		}
+		if user.VerifiedAt == nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Please verify your email address first", "code": "email_not_verified"})
+		}
+
 		return c.Next()
 	}
 }
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"spendwise-backend/internal/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type rateLimitCheck struct {
+	key   string
+	limit ratelimit.Limit
+}
+
+// RateLimit limits requests per client IP and per account. The account is
+// the "email" of a JSON body (logins, signups, password resets) or the
+// logged-in user when it runs after Protected. Limits are read from
+// RATE_LIMIT_<NAME> and RATE_LIMIT_<NAME>_ACCOUNT (e.g. "30/1m" or "off"),
+// falling back to perIP and perAccount.
+func RateLimit(name string, perIP, perAccount ratelimit.Limit) fiber.Handler {
+	envName := "RATE_LIMIT_" + strings.ToUpper(name)
+	perIP = ratelimit.LimitFromEnv(envName, perIP)
+	perAccount = ratelimit.LimitFromEnv(envName+"_ACCOUNT", perAccount)
+
+	if !perIP.Enabled() && !perAccount.Enabled() {
+		return func(c *fiber.Ctx) error { return c.Next() }
+	}
+
+	return func(c *fiber.Ctx) error {
+		checks := []rateLimitCheck{{name + ":ip:" + c.IP(), perIP}}
+		if account := rateLimitAccount(c); account != "" {
+			checks = append(checks, rateLimitCheck{name + ":account:" + account, perAccount})
+		}
+
+		for _, check := range checks {
+			ok, retryAfter, err := ratelimit.Allow(c.Context(), ratelimit.Default, check.key, check.limit)
+			if err != nil {
+				// Better to serve unlimited than not at all
+				log.Printf("Rate limit check failed: %v", err)
+				continue
+			}
+			if !ok {
+				c.Set(fiber.HeaderRetryAfter, ratelimit.RetryAfter(retryAfter))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "Too many requests, please try again later"})
+			}
+		}
+
+		return c.Next()
+	}
+}
+
+func rateLimitAccount(c *fiber.Ctx) string {
+	if userID, ok := c.Locals("user_id").(uint); ok {
+		return fmt.Sprintf("user:%d", userID)
+	}
+
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		return ""
+	}
+	var body struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(c.Body(), &body) != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(body.Email))
+}
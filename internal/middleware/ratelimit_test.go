@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"spendwise-backend/internal/ratelimit"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimit(t *testing.T) {
+	ratelimit.Default = ratelimit.NewMemory()
+	app := fiber.New()
+	app.Post("/login", RateLimit("test",
+		ratelimit.Limit{Requests: 3, Window: time.Minute},
+		ratelimit.Limit{Requests: 2, Window: time.Minute},
+	), func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	login := func(email string) (int, string) {
+		req := httptest.NewRequest("POST", "/login", bytes.NewReader([]byte(`{"email":"`+email+`"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get("Retry-After")
+	}
+
+	t.Run("Per Account", func(t *testing.T) {
+		status, _ := login("a@example.com")
+		assert.Equal(t, 200, status)
+		status, _ = login("A@example.com")
+		assert.Equal(t, 200, status)
+		status, retryAfter := login("a@example.com")
+		assert.Equal(t, 429, status)
+		assert.NotEmpty(t, retryAfter)
+	})
+
+	t.Run("Per IP", func(t *testing.T) {
+		// The third request from this IP used up its budget above
+		status, _ := login("b@example.com")
+		assert.Equal(t, 429, status)
+	})
+}
@@ -1,21 +1,176 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID            uint      `gorm:"primaryKey" json:"id"`
-	Email         string    `gorm:"unique;not null" json:"email"`
-	PasswordHash  string    `gorm:"not null" json:"-"`
-	FullName      string    `gorm:"not null" json:"full_name"`
-	Phone         string    `json:"phone"`
-	AvatarURL     string    `json:"avatar_url"`
-	WalletBalance float64   `gorm:"default:0" json:"wallet_balance"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Email         string     `gorm:"unique;not null" json:"email"`
+	PasswordHash  string     `gorm:"not null" json:"-"`
+	FullName      string     `gorm:"not null" json:"full_name"`
+	Phone         string     `json:"phone"`
+	AvatarURL     string     `json:"avatar_url"`
+	WalletBalance float64    `gorm:"default:0" json:"wallet_balance"`
+	VerifiedAt    *time.Time `json:"verified_at"`             // When the email address was confirmed
+	TOTPSecret    string     `json:"-"`                       // Sealed; set on enrolment, before it is enabled
+	TOTPEnabledAt *time.Time `json:"totp_enabled_at"`         // Two-factor login is on when set
+	TOTPLastStep  int64      `gorm:"default:0" json:"-"`      // Last accepted time step, to refuse replays
+	TokenVersion  int        `gorm:"default:0" json:"-"`      // Bumped to invalidate every issued token
+	AnonymizedAt  *time.Time `json:"anonymized_at,omitempty"` // Set when the account was deleted; the row stays for group ledgers
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// SchemaMigration records a one-off data migration that has been applied.
+type SchemaMigration struct {
+	ID        string    `gorm:"primaryKey;size:100"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+// RateLimitCounter backs the Postgres rate limit store.
+type RateLimitCounter struct {
+	Key     string    `gorm:"primaryKey;size:200"`
+	Count   int       `gorm:"not null"`
+	ResetAt time.Time `gorm:"not null;index"`
+}
+
+// UserIdentity links a user to their account at an OIDC provider.
+type UserIdentity struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	Provider    string    `gorm:"size:50;not null;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject     string    `gorm:"size:255;not null;uniqueIndex:idx_identity_subject" json:"-"`
+	Email       string    `json:"email"` // As reported by the provider
+	LastLoginAt time.Time `json:"last_login_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OIDCLoginState remembers an SSO login between the redirect to the
+// provider and its callback. Each state is used once.
+type OIDCLoginState struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	StateHash    string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Provider     string    `gorm:"size:50;not null" json:"provider"`
+	CodeVerifier string    `gorm:"size:100;not null" json:"-"`
+	Nonce        string    `gorm:"size:100;not null" json:"-"`
+	RedirectPath string    `json:"redirect_path"` // Frontend path to return to
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator is lost. Only a hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"size:64;not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EmailVerificationToken confirms that a user owns their email address.
+// Tokens are single-use, expire and are stored only as hashes.
+type EmailVerificationToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken lets a user who forgot their password set a new one.
+// Tokens are single-use, expire and are stored only as hashes.
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Session is one login of a user on a device. Its refresh tokens are
+// rotated on every use; presenting a used one again revokes the session.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	DeviceName string     `gorm:"size:100" json:"device_name"`
+	UserAgent  string     `gorm:"size:500" json:"user_agent"`
+	IPAddress  string     `gorm:"size:45" json:"ip_address"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"` // Pushed back with every refresh
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Transient field
+	Current bool `gorm:"-" json:"current"`
+}
+
+// RefreshToken is a single-use token exchanged for a new access token.
+// Only a hash is stored.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	SessionID uint       `gorm:"not null;index" json:"session_id"`
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// API key scopes. A key only reaches the routes that accept one of its
+// scopes.
+const (
+	ScopeExpensesRead  = "expenses:read"
+	ScopeExpensesWrite = "expenses:write"
+	ScopeApprovals     = "approvals"
+)
+
+var APIKeyScopes = []string{ScopeExpensesRead, ScopeExpensesWrite, ScopeApprovals}
+
+// APIKeyPrefix starts every API key, so middleware can tell them from JWTs.
+const APIKeyPrefix = "swk_"
+
+// APIKey lets scripts and integrations act as a user without a login. Only
+// a hash of the key is stored; it is shown once when created.
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:20;not null" json:"prefix"` // Start of the key, to tell keys apart
+	KeyHash    string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Scopes     []string   `gorm:"serializer:json" json:"scopes"`
+	GroupID    *uint      `gorm:"index" json:"group_id"` // Restricts the key to one group
+	ExpiresAt  *time.Time `json:"expires_at"`            // Nil never expires
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"size:45" json:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HashAPIKey is how API keys are stored and looked up.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
 }
 
 type ExpenseGroup struct {
@@ -26,6 +181,20 @@ type ExpenseGroup struct {
 	CreatedBy   uint      `gorm:"not null" json:"created_by"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	ApprovalSLAHours   int   `gorm:"default:0" json:"approval_sla_hours"` // 0 disables SLA tracking
+	FallbackApproverID *uint `json:"fallback_approver_id"`                // Escalation target; group admins if nil
+
+	RequireTwoFactor bool `gorm:"default:false" json:"require_two_factor"` // Approvers and admins must use 2FA
+}
+
+// ApprovalDeadline returns when a request created at createdAt must be
+// decided by, or false if the group has no SLA.
+func (g *ExpenseGroup) ApprovalDeadline(createdAt time.Time) (time.Time, bool) {
+	if g.ApprovalSLAHours <= 0 {
+		return time.Time{}, false
+	}
+	return createdAt.Add(time.Duration(g.ApprovalSLAHours) * time.Hour), true
 }
 
 type GroupMember struct {
@@ -51,30 +220,97 @@ type ExpenseRequest struct {
 	RequesterID     uint                `gorm:"not null;index" json:"requester_id"`
 	Title           string              `gorm:"not null" json:"title"`
 	Category        string              `gorm:"not null" json:"category"`
+	CategoryID      *uint               `gorm:"index" json:"category_id"` // Catalog entry; Category keeps its name
 	Amount          float64             `gorm:"not null" json:"amount"`
 	Description     string              `json:"description"`
+	SplitMethod     string              `json:"split_method"`                    // equal, exact, percent, shares; empty when not split
 	Status          string              `gorm:"default:'pending'" json:"status"` // pending, approved, rejected
 	ApprovedBy      *uint               `json:"approved_by"`
 	ApprovedAt      *time.Time          `json:"approved_at"`
 	RejectionReason string              `json:"rejection_reason"`
+	OnBehalfOfID    *uint               `json:"on_behalf_of_id"` // Set when a delegate decided for the target approver
+	EscalatedAt     *time.Time          `json:"escalated_at"`
+	EscalatedToID   *uint               `json:"escalated_to_id"` // nil with EscalatedAt set means group admins
+	RecurringID     *uint               `gorm:"uniqueIndex:idx_recurring_occurrence" json:"recurring_id"`
+	OccurrenceAt    *time.Time          `gorm:"uniqueIndex:idx_recurring_occurrence" json:"occurrence_at"` // Scheduled run that generated this expense
 	CreatedAt       time.Time           `json:"created_at"`
 	UpdatedAt       time.Time           `json:"updated_at"`
 	TargetUserID    *uint               `json:"target_user_id"` // Specific approver (optional)
 	TargetUser      *User               `gorm:"foreignKey:TargetUserID" json:"target_user,omitempty"`
 	Requester       User                `gorm:"foreignKey:RequesterID" json:"requester,omitempty"`
+	CategoryRef     *Category           `gorm:"foreignKey:CategoryID" json:"category_ref,omitempty"`
 	Attachments     []ExpenseAttachment `gorm:"foreignKey:ExpenseID" json:"attachments,omitempty"`
 	ApprovalSlips   []ApprovalSlip      `gorm:"foreignKey:ExpenseID" json:"approval_slips,omitempty"`
+	AuditLogs       []ExpenseAuditLog   `gorm:"foreignKey:ExpenseID" json:"audit_logs,omitempty"`
+	Escalations     []ExpenseEscalation `gorm:"foreignKey:ExpenseID" json:"escalations,omitempty"`
+	Tags            []ExpenseTag        `gorm:"foreignKey:ExpenseID" json:"tags,omitempty"`
+	FieldValues     []ExpenseFieldValue `gorm:"foreignKey:ExpenseID" json:"custom_fields,omitempty"`
+	Splits          []ExpenseSplit      `gorm:"foreignKey:ExpenseID" json:"splits,omitempty"`
+
+	// Computed per request in ListApprovals, not persisted
+	CanDecide        bool       `gorm:"-" json:"can_decide"`
+	ActingOnBehalfOf *uint      `gorm:"-" json:"acting_on_behalf_of,omitempty"`
+	DueAt            *time.Time `gorm:"-" json:"due_at,omitempty"`
+	IsOverdue        bool       `gorm:"-" json:"is_overdue"`
+	AgeHours         float64    `gorm:"-" json:"age_hours"`
+
+	// Computed in CreateExpense/ApproveExpense, not persisted
+	BudgetWarnings []BudgetAlert `gorm:"-" json:"budget_warnings,omitempty"`
 }
 
 type ExpenseAttachment struct {
-	ID         uint      `gorm:"primaryKey" json:"id"`
-	ExpenseID  uint      `gorm:"not null;index" json:"expense_id"`
-	FileName   string    `gorm:"not null" json:"file_name"`
-	FilePath   string    `gorm:"not null" json:"file_path"`
-	FileSize   int64     `json:"file_size"`
-	FileType   string    `json:"file_type"`
-	UploadedBy uint      `gorm:"not null" json:"uploaded_by"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	ID         uint               `gorm:"primaryKey" json:"id"`
+	ExpenseID  uint               `gorm:"not null;index" json:"expense_id"`
+	FileName   string             `gorm:"not null" json:"file_name"`
+	FilePath   string             `gorm:"not null" json:"file_path"`
+	FileSize   int64              `json:"file_size"`
+	FileType   string             `json:"file_type"`
+	UploadedBy uint               `gorm:"not null" json:"uploaded_by"`
+	UploadedAt time.Time          `json:"uploaded_at"`
+	Extraction *ReceiptExtraction `gorm:"foreignKey:AttachmentID" json:"extraction,omitempty"`
+
+	ThumbnailPath string `json:"-"` // Storage key, empty for PDFs
+	SHA256        string `gorm:"size:64;index" json:"sha256"`
+
+	URL          string `gorm:"-" json:"url"`
+	ThumbnailURL string `gorm:"-" json:"thumbnail_url,omitempty"`
+
+	// Set when the same file is attached to other expenses of the group
+	ReusedInExpenseIDs []uint `gorm:"-" json:"reused_in_expense_ids,omitempty"`
+	ReusedElsewhere    bool   `gorm:"-" json:"reused_elsewhere,omitempty"`
+}
+
+// FilePath holds the storage key; URL is the authorized download route
+func (a *ExpenseAttachment) AfterFind(tx *gorm.DB) error {
+	a.URL = fmt.Sprintf("/api/storage/attachments/%d/download", a.ID)
+	if a.ThumbnailPath != "" {
+		a.ThumbnailURL = fmt.Sprintf("/api/storage/attachments/%d/thumbnail", a.ID)
+	}
+	return nil
+}
+
+func (a *ExpenseAttachment) AfterSave(tx *gorm.DB) error {
+	return a.AfterFind(tx)
+}
+
+// ReceiptExtraction is the OCR result for one attachment, used to suggest
+// expense details.
+type ReceiptExtraction struct {
+	ID              uint               `gorm:"primaryKey" json:"id"`
+	AttachmentID    uint               `gorm:"not null;uniqueIndex" json:"attachment_id"`
+	ExpenseID       uint               `gorm:"not null;index" json:"expense_id"`
+	Engine          string             `json:"engine"`
+	Status          string             `gorm:"not null;index" json:"status"` // pending, processing, completed, failed, unsupported
+	Merchant        string             `json:"merchant"`
+	Total           *float64           `json:"total"`
+	Tax             *float64           `json:"tax"`
+	ReceiptDate     *time.Time         `json:"receipt_date"`
+	Confidence      float64            `json:"confidence"`
+	FieldConfidence map[string]float64 `gorm:"serializer:json" json:"field_confidence"`
+	RawText         string             `gorm:"type:text" json:"raw_text"`
+	Error           string             `json:"error,omitempty"`
+	StartedAt       *time.Time         `json:"started_at,omitempty"`
+	CreatedAt       time.Time          `json:"created_at"`
 }
 
 type ApprovalSlip struct {
@@ -89,19 +325,283 @@ type ApprovalSlip struct {
 	SlipOKData string    `gorm:"type:text" json:"slipok_data"` // Storing JSON as text for simplicity
 	UploadedBy uint      `gorm:"not null" json:"uploaded_by"`
 	UploadedAt time.Time `json:"uploaded_at"`
+
+	URL string `gorm:"-" json:"url"`
+}
+
+func (s *ApprovalSlip) AfterFind(tx *gorm.DB) error {
+	s.URL = fmt.Sprintf("/api/storage/slips/%d/download", s.ID)
+	return nil
+}
+
+func (s *ApprovalSlip) AfterSave(tx *gorm.DB) error {
+	return s.AfterFind(tx)
+}
+
+// UploadURL is the public URL of a stored avatar.
+func UploadURL(key string) string {
+	return "/uploads/" + key
+}
+
+// UploadKey extracts the storage key from a URL built by UploadURL.
+func UploadKey(url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, "/uploads/")
+	return key, ok && key != ""
 }
 
 type WalletTransaction struct {
-	ID          uint      `gorm:"primaryKey" json:"id"`
-	UserID      uint      `gorm:"not null;index" json:"user_id"`
-	Amount      float64   `gorm:"not null" json:"amount"`
-	Type        string    `gorm:"not null" json:"type"` // credit, debit
-	Description string    `json:"description"`
-	ReferenceID uint      `json:"reference_id"` // E.g., ExpenseID
-	CreatedAt   time.Time `json:"created_at"`
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	UserID       uint      `gorm:"not null;index" json:"user_id"`
+	Amount       float64   `gorm:"not null" json:"amount"`
+	Type         string    `gorm:"not null" json:"type"` // credit, debit
+	Description  string    `json:"description"`
+	ReferenceID  uint      `json:"reference_id"`  // E.g., ExpenseID
+	SettlementID *uint     `json:"settlement_id"` // Set on both legs of a settle-up transfer
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ApprovalDelegation struct {
+	ID          uint          `gorm:"primaryKey" json:"id"`
+	DelegatorID uint          `gorm:"not null;index" json:"delegator_id"`
+	DelegateID  uint          `gorm:"not null;index" json:"delegate_id"`
+	GroupID     *uint         `gorm:"index" json:"group_id"` // nil means all groups
+	StartsAt    time.Time     `gorm:"not null" json:"starts_at"`
+	EndsAt      time.Time     `gorm:"not null" json:"ends_at"`
+	Reason      string        `json:"reason"`
+	CreatedAt   time.Time     `json:"created_at"`
+	Delegator   User          `gorm:"foreignKey:DelegatorID" json:"delegator,omitempty"`
+	Delegate    User          `gorm:"foreignKey:DelegateID" json:"delegate,omitempty"`
+	Group       *ExpenseGroup `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+}
+
+type ExpenseAuditLog struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ExpenseID    uint      `gorm:"not null;index" json:"expense_id"`
+	Action       string    `gorm:"not null" json:"action"` // approved, rejected
+	ActorID      uint      `gorm:"not null" json:"actor_id"`
+	OnBehalfOfID *uint     `json:"on_behalf_of_id"`
+	Message      string    `json:"message"` // E.g., "approved by X on behalf of Y"
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type ExpenseEscalation struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	ExpenseID        uint      `gorm:"not null;index" json:"expense_id"`
+	GroupID          uint      `gorm:"not null;index" json:"group_id"`
+	PreviousTargetID *uint     `json:"previous_target_id"`
+	EscalatedToID    *uint     `json:"escalated_to_id"` // nil means group admins
+	AgeHours         float64   `json:"age_hours"`
+	SLAHours         int       `json:"sla_hours"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type RecurringExpense struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	GroupID        uint       `gorm:"not null;index" json:"group_id"`
+	RequesterID    uint       `gorm:"not null;index" json:"requester_id"`
+	Title          string     `gorm:"not null" json:"title"`
+	Category       string     `gorm:"not null" json:"category"`
+	CategoryID     *uint      `json:"category_id"`
+	Amount         float64    `gorm:"not null" json:"amount"`
+	Description    string     `json:"description"`
+	TargetUserID   *uint      `json:"target_user_id"`
+	IsDirectRecord bool       `json:"is_direct_record"`          // Generate approved expenses that debit the wallet
+	Frequency      string     `gorm:"not null" json:"frequency"` // monthly, weekly, cron
+	DayOfMonth     int        `json:"day_of_month"`
+	Weekday        int        `json:"weekday"`
+	Hour           int        `json:"hour"`
+	Minute         int        `json:"minute"`
+	CronExpr       string     `json:"cron_expr"`
+	StartsAt       time.Time  `gorm:"not null" json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"`
+	NextRunAt      *time.Time `gorm:"index" json:"next_run_at"` // nil once the schedule has finished
+	LastRunAt      *time.Time `json:"last_run_at"`
+	IsActive       bool       `gorm:"default:true" json:"is_active"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type Budget struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	GroupID     uint       `gorm:"not null;index" json:"group_id"`
+	Name        string     `json:"name" validate:"max=100"`
+	Category    string     `json:"category" validate:"max=100"`                                               // Empty applies to all categories
+	Period      string     `gorm:"not null" json:"period" validate:"required,oneof=monthly quarterly custom"` // monthly, quarterly, custom
+	StartsAt    *time.Time `json:"starts_at"`                                                                 // Required for custom periods
+	EndsAt      *time.Time `json:"ends_at"`                                                                   // Required for custom periods
+	Amount      float64    `gorm:"not null" json:"amount" validate:"required,gt=0"`                           // Spending limit for one period
+	WarnPercent float64    `gorm:"default:80" json:"warn_percent"`
+	Enforcement string     `gorm:"default:'warn'" json:"enforcement" validate:"oneof=warn block"` // warn, block
+	CreatedBy   uint       `gorm:"not null" json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// BudgetAlert describes how an expense affects a budget. It is returned to
+// clients and never stored.
+type BudgetAlert struct {
+	BudgetID    uint      `json:"budget_id"`
+	Name        string    `json:"name"`
+	Category    string    `json:"category"`
+	PeriodStart time.Time `json:"period_start"`
+	PeriodEnd   time.Time `json:"period_end"`
+	Limit       float64   `json:"limit"`
+	Spent       float64   `json:"spent"`
+	Projected   float64   `json:"projected"`
+	Percent     float64   `json:"percent"`
+	Level       string    `json:"level"` // warning, exceeded
+	Blocking    bool      `json:"blocking"`
+}
+
+type Category struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	GroupID   uint      `gorm:"not null;uniqueIndex:idx_group_category_name" json:"group_id"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_group_category_name" json:"name"`
+	Icon      string    `json:"icon"`
+	Color     string    `json:"color"`
+	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	ParentID  *uint     `gorm:"index" json:"parent_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ExpenseTag struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ExpenseID uint   `gorm:"not null;uniqueIndex:idx_expense_tag" json:"expense_id"`
+	Tag       string `gorm:"not null;uniqueIndex:idx_expense_tag;index" json:"tag"` // Lowercased
+}
+
+type CustomField struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	GroupID   uint      `gorm:"not null;uniqueIndex:idx_group_field_key" json:"group_id"`
+	Key       string    `gorm:"not null;uniqueIndex:idx_group_field_key" json:"key"` // E.g., project_code
+	Label     string    `gorm:"not null" json:"label"`
+	Type      string    `gorm:"not null" json:"type"`           // text, number, date, select
+	Options   []string  `gorm:"serializer:json" json:"options"` // Allowed values for select
+	Required  bool      `json:"required"`
+	IsActive  bool      `gorm:"default:true" json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ExpenseFieldValue struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	ExpenseID uint   `gorm:"not null;uniqueIndex:idx_expense_field" json:"expense_id"`
+	FieldID   uint   `gorm:"not null;uniqueIndex:idx_expense_field;index" json:"field_id"`
+	Key       string `gorm:"not null" json:"key"`
+	Value     string `gorm:"not null" json:"value"` // Normalized: numbers as decimals, dates as YYYY-MM-DD
+}
+
+// ExpenseSplit is one participant's share of a split expense. Whoever paid
+// the expense (its approver) is owed every other participant's share.
+type ExpenseSplit struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	ExpenseID uint       `gorm:"not null;uniqueIndex:idx_expense_split_user" json:"expense_id"`
+	UserID    uint       `gorm:"not null;uniqueIndex:idx_expense_split_user;index" json:"user_id"`
+	Amount    float64    `gorm:"not null" json:"amount"`
+	Percent   float64    `json:"percent,omitempty"`
+	Shares    float64    `json:"shares,omitempty"`
+	ClearedAt *time.Time `gorm:"index" json:"cleared_at"` // Set once the group has been settled up
+	CreatedAt time.Time  `json:"created_at"`
+	User      User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// Settlement records one member paying another to settle split debts. The
+// money moves as a linked debit/credit pair of WalletTransactions.
+type Settlement struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	GroupID    uint       `gorm:"not null;index" json:"group_id"`
+	FromUserID uint       `gorm:"not null;index" json:"from_user_id"`
+	ToUserID   uint       `gorm:"not null;index" json:"to_user_id"`
+	Amount     float64    `gorm:"not null" json:"amount"`
+	Note       string     `json:"note"`
+	ClearedAt  *time.Time `gorm:"index" json:"cleared_at"` // Set once the group has been settled up
+	CreatedAt  time.Time  `json:"created_at"`
+	FromUser   User       `gorm:"foreignKey:FromUserID" json:"from_user,omitempty"`
+	ToUser     User       `gorm:"foreignKey:ToUserID" json:"to_user,omitempty"`
+}
+
+// migrateTokenFamilies turns each family of refresh tokens, which grouped
+// the tokens of one login before sessions existed, into a session so those
+// logins keep working.
+func migrateTokenFamilies(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.AutoMigrate(&Session{}); err != nil {
+			return err
+		}
+		if err := tx.Exec("ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id bigint").Error; err != nil {
+			return err
+		}
+
+		type family struct {
+			FamilyID   string
+			UserID     uint
+			CreatedAt  time.Time
+			LastSeenAt time.Time
+			ExpiresAt  time.Time
+			Active     bool
+		}
+		var families []family
+		if err := tx.Table("refresh_tokens").
+			Select("family_id, user_id, MIN(created_at) AS created_at, MAX(created_at) AS last_seen_at, " +
+				"MAX(expires_at) AS expires_at, BOOL_OR(revoked_at IS NULL) AS active").
+			Where("session_id IS NULL").
+			Group("family_id, user_id").
+			Scan(&families).Error; err != nil {
+			return err
+		}
+
+		for _, f := range families {
+			session := Session{
+				UserID:     f.UserID,
+				DeviceName: "Unknown device",
+				LastSeenAt: f.LastSeenAt,
+				ExpiresAt:  f.ExpiresAt,
+				CreatedAt:  f.CreatedAt,
+			}
+			if !f.Active {
+				session.RevokedAt = &f.LastSeenAt
+			}
+			if err := tx.Create(&session).Error; err != nil {
+				return err
+			}
+			if err := tx.Table("refresh_tokens").
+				Where("family_id = ? AND user_id = ?", f.FamilyID, f.UserID).
+				Update("session_id", session.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Migrator().DropColumn(&RefreshToken{}, "family_id")
+	})
+}
+
+// runOnce applies a data migration and records it in the same transaction,
+// so it never runs again on later boots.
+func runOnce(db *gorm.DB, id string, migrate func(tx *gorm.DB) error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var done int64
+		if err := tx.Model(&SchemaMigration{}).Where("id = ?", id).Count(&done).Error; err != nil || done > 0 {
+			return err
+		}
+		if err := migrate(tx); err != nil {
+			return err
+		}
+		return tx.Create(&SchemaMigration{ID: id, AppliedAt: time.Now()}).Error
+	})
+	if err != nil {
+		log.Fatalf("Migration %s failed: %v", id, err)
+	}
 }
 
 func Migrate(db *gorm.DB) {
+	if db.Migrator().HasColumn(&RefreshToken{}, "family_id") {
+		if err := migrateTokenFamilies(db); err != nil {
+			log.Fatal("Failed to move refresh tokens into sessions: ", err)
+		}
+	}
+	hadVerifiedAt := !db.Migrator().HasTable(&User{}) || db.Migrator().HasColumn(&User{}, "verified_at")
+
 	db.AutoMigrate(
 		&User{},
 		&ExpenseGroup{},
@@ -111,5 +611,52 @@ func Migrate(db *gorm.DB) {
 		&ExpenseAttachment{},
 		&ApprovalSlip{},
 		&WalletTransaction{},
+		&ApprovalDelegation{},
+		&ExpenseAuditLog{},
+		&ExpenseEscalation{},
+		&RecurringExpense{},
+		&Budget{},
+		&Category{},
+		&ExpenseTag{},
+		&CustomField{},
+		&ExpenseFieldValue{},
+		&ExpenseSplit{},
+		&Settlement{},
+		&ReceiptExtraction{},
+		&Session{},
+		&RefreshToken{},
+		&PasswordResetToken{},
+		&EmailVerificationToken{},
+		&RecoveryCode{},
+		&UserIdentity{},
+		&OIDCLoginState{},
+		&RateLimitCounter{},
+		&APIKey{},
+		&SchemaMigration{},
 	)
+
+	// Groups from before the approval settings existed get their defaults
+	runOnce(db, "group-approval-defaults", func(tx *gorm.DB) error {
+		if err := tx.Model(&ExpenseGroup{}).Where("approval_sla_hours IS NULL").Update("approval_sla_hours", 0).Error; err != nil {
+			return err
+		}
+		return tx.Model(&ExpenseGroup{}).Where("require_two_factor IS NULL").Update("require_two_factor", false).Error
+	})
+
+	// Accounts created before email verification existed keep working
+	if !hadVerifiedAt {
+		db.Model(&User{}).Where("verified_at IS NULL").Update("verified_at", gorm.Expr("created_at"))
+	}
+
+	// Files stored before the storage backend kept public paths; the part
+	// after /uploads/ is the key in the local backend
+	runOnce(db, "upload-paths-to-keys", func(tx *gorm.DB) error {
+		for _, model := range []interface{}{&ExpenseAttachment{}, &ApprovalSlip{}} {
+			if err := tx.Model(model).Where("file_path LIKE ?", "/uploads/%").
+				Update("file_path", gorm.Expr("SUBSTRING(file_path FROM 10)")).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
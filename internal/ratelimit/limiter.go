@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"spendwise-backend/internal/jobs"
+)
+
+// Limit allows Requests per Window. A zero limit allows everything.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Window > 0
+}
+
+func (l Limit) String() string {
+	return fmt.Sprintf("%d/%s", l.Requests, l.Window)
+}
+
+// ParseLimit reads limits such as "30/1m" or "1000/1h"; "off" and "0"
+// disable limiting.
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(strings.ToLower(s))
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+
+	count, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("rate limit %q is not requests/window", s)
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid request count", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("rate limit %q has an invalid window", s)
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+// LimitFromEnv reads a limit from the environment, falling back to def when
+// unset or invalid.
+func LimitFromEnv(key string, def Limit) Limit {
+	if v := os.Getenv(key); v != "" {
+		limit, err := ParseLimit(v)
+		if err == nil {
+			return limit
+		}
+		log.Printf("Invalid %s=%q, using %s: %v", key, v, def, err)
+	}
+	return def
+}
+
+// Allow counts a hit on key and reports whether it is within the limit,
+// and if not, how long until the window ends.
+func Allow(ctx context.Context, store Store, key string, limit Limit) (ok bool, retryAfter time.Duration, err error) {
+	if !limit.Enabled() {
+		return true, 0, nil
+	}
+	counter, err := store.Increment(ctx, key, limit.Window)
+	if err != nil {
+		return false, 0, err
+	}
+	if counter.Count > limit.Requests {
+		return false, time.Until(counter.ResetAt), nil
+	}
+	return true, 0, nil
+}
+
+// Lockout locks an account out after repeated failed logins. Each failure
+// past Threshold doubles the lock, from Base up to Max. Failures are
+// forgotten Window after the first one, or on a successful login.
+type Lockout struct {
+	Store     Store
+	Threshold int
+	Base      time.Duration
+	Max       time.Duration
+	Window    time.Duration
+}
+
+// DefaultLockout reads LOGIN_LOCKOUT_THRESHOLD (default 5 failures),
+// LOGIN_LOCKOUT_BASE (30s), LOGIN_LOCKOUT_MAX (1h) and LOGIN_LOCKOUT_WINDOW
+// (24h).
+func DefaultLockout() *Lockout {
+	threshold := 5
+	if v, err := strconv.Atoi(os.Getenv("LOGIN_LOCKOUT_THRESHOLD")); err == nil && v > 0 {
+		threshold = v
+	}
+	return &Lockout{
+		Store:     Default,
+		Threshold: threshold,
+		Base:      jobs.IntervalFromEnv("LOGIN_LOCKOUT_BASE", 30*time.Second),
+		Max:       jobs.IntervalFromEnv("LOGIN_LOCKOUT_MAX", time.Hour),
+		Window:    jobs.IntervalFromEnv("LOGIN_LOCKOUT_WINDOW", 24*time.Hour),
+	}
+}
+
+func lockKey(account string) string     { return "lock:" + strings.ToLower(account) }
+func failuresKey(account string) string { return "failures:" + strings.ToLower(account) }
+
+// Locked reports how much longer the account is locked, if at all.
+func (l *Lockout) Locked(ctx context.Context, account string) (time.Duration, error) {
+	counter, err := l.Store.Get(ctx, lockKey(account))
+	if err != nil || counter.Count == 0 {
+		return 0, err
+	}
+	return time.Until(counter.ResetAt), nil
+}
+
+// Fail records a failed login and returns the lock it triggered, if any.
+func (l *Lockout) Fail(ctx context.Context, account string) (time.Duration, error) {
+	counter, err := l.Store.Increment(ctx, failuresKey(account), l.Window)
+	if err != nil {
+		return 0, err
+	}
+	lock := l.delay(counter.Count)
+	if lock == 0 {
+		return 0, nil
+	}
+	return lock, l.Store.Set(ctx, lockKey(account), Counter{Count: 1, ResetAt: time.Now().Add(lock)})
+}
+
+// Succeed clears the failures of an account.
+func (l *Lockout) Succeed(ctx context.Context, account string) error {
+	if err := l.Store.Delete(ctx, failuresKey(account)); err != nil {
+		return err
+	}
+	return l.Store.Delete(ctx, lockKey(account))
+}
+
+func (l *Lockout) delay(failures int) time.Duration {
+	if failures < l.Threshold {
+		return 0
+	}
+	delay := l.Base
+	for i := l.Threshold; i < failures && delay < l.Max; i++ {
+		delay *= 2
+	}
+	return min(delay, l.Max)
+}
+
+// RetryAfter formats a wait for the Retry-After header, in whole seconds
+// rounded up.
+func RetryAfter(d time.Duration) string {
+	seconds := int((d + time.Second - 1) / time.Second)
+	return strconv.Itoa(max(seconds, 1))
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps counters in the process, so every instance limits on its
+// own.
+type Memory struct {
+	mu       sync.Mutex
+	counters map[string]Counter
+	now      func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{counters: map[string]Counter{}, now: time.Now}
+}
+
+func (m *Memory) Increment(ctx context.Context, key string, window time.Duration) (Counter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	counter := m.counters[key]
+	if !now.Before(counter.ResetAt) {
+		counter = Counter{ResetAt: now.Add(window)}
+	}
+	counter.Count++
+	m.counters[key] = counter
+	return counter, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (Counter, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	counter := m.counters[key]
+	if !m.now().Before(counter.ResetAt) {
+		return Counter{}, nil
+	}
+	return counter, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, counter Counter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[key] = counter
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.counters, key)
+	return nil
+}
+
+func (m *Memory) Cleanup(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for key, counter := range m.counters {
+		if !now.Before(counter.ResetAt) {
+			delete(m.counters, key)
+		}
+	}
+	return nil
+}
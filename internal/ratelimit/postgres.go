@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"spendwise-backend/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Postgres keeps counters in the rate_limit_counters table, so limits hold
+// across instances.
+type Postgres struct {
+	DB *gorm.DB
+}
+
+func NewPostgres(db *gorm.DB) *Postgres {
+	return &Postgres{DB: db}
+}
+
+func (p *Postgres) Increment(ctx context.Context, key string, window time.Duration) (Counter, error) {
+	now := time.Now()
+
+	// One statement, so concurrent hits cannot both start a fresh window
+	var counter Counter
+	err := p.DB.WithContext(ctx).Raw(`
+		INSERT INTO rate_limit_counters ("key", count, reset_at) VALUES (?, 1, ?)
+		ON CONFLICT ("key") DO UPDATE SET
+			count = CASE WHEN rate_limit_counters.reset_at <= ? THEN 1 ELSE rate_limit_counters.count + 1 END,
+			reset_at = CASE WHEN rate_limit_counters.reset_at <= ? THEN EXCLUDED.reset_at ELSE rate_limit_counters.reset_at END
+		RETURNING count, reset_at`,
+		key, now.Add(window), now, now,
+	).Row().Scan(&counter.Count, &counter.ResetAt)
+	return counter, err
+}
+
+func (p *Postgres) Get(ctx context.Context, key string) (Counter, error) {
+	var row models.RateLimitCounter
+	err := p.DB.WithContext(ctx).Where(`"key" = ? AND reset_at > ?`, key, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Counter{}, nil
+	}
+	if err != nil {
+		return Counter{}, err
+	}
+	return Counter{Count: row.Count, ResetAt: row.ResetAt}, nil
+}
+
+func (p *Postgres) Set(ctx context.Context, key string, counter Counter) error {
+	row := models.RateLimitCounter{Key: key, Count: counter.Count, ResetAt: counter.ResetAt}
+	return p.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"count", "reset_at"}),
+	}).Create(&row).Error
+}
+
+func (p *Postgres) Delete(ctx context.Context, key string) error {
+	return p.DB.WithContext(ctx).Where(`"key" = ?`, key).Delete(&models.RateLimitCounter{}).Error
+}
+
+func (p *Postgres) Cleanup(ctx context.Context) error {
+	return p.DB.WithContext(ctx).Where("reset_at <= ?", time.Now()).Delete(&models.RateLimitCounter{}).Error
+}
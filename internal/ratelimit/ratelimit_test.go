@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLimit(t *testing.T) {
+	limit, err := ParseLimit("30/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 30, Window: time.Minute}, limit)
+
+	limit, err = ParseLimit("off")
+	assert.NoError(t, err)
+	assert.False(t, limit.Enabled())
+
+	for _, bad := range []string{"30", "x/1m", "30/soon", "-1/1m", "10/0s"} {
+		_, err := ParseLimit(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestMemoryWindow(t *testing.T) {
+	store := NewMemory()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		counter, _ := store.Increment(ctx, "k", time.Minute)
+		assert.Equal(t, i, counter.Count)
+		assert.Equal(t, now.Add(time.Minute), counter.ResetAt)
+	}
+
+	// A new window starts once the old one is over
+	now = now.Add(time.Minute)
+	counter, _ := store.Increment(ctx, "k", time.Minute)
+	assert.Equal(t, 1, counter.Count)
+
+	now = now.Add(2 * time.Minute)
+	counter, _ = store.Get(ctx, "k")
+	assert.Equal(t, 0, counter.Count)
+
+	store.Cleanup(ctx)
+	assert.Empty(t, store.counters)
+}
+
+func TestAllow(t *testing.T) {
+	store := NewMemory()
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Window: time.Minute}
+
+	for i := 0; i < 2; i++ {
+		ok, _, err := Allow(ctx, store, "ip:1.2.3.4", limit)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+	ok, retryAfter, _ := Allow(ctx, store, "ip:1.2.3.4", limit)
+	assert.False(t, ok)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Minute)
+
+	// Other keys have their own budget
+	ok, _, _ = Allow(ctx, store, "ip:5.6.7.8", limit)
+	assert.True(t, ok)
+}
+
+func TestLockout(t *testing.T) {
+	lockout := &Lockout{Store: NewMemory(), Threshold: 3, Base: 30 * time.Second, Max: 2 * time.Minute, Window: time.Hour}
+	ctx := context.Background()
+
+	var delays []time.Duration
+	for i := 0; i < 6; i++ {
+		d, err := lockout.Fail(ctx, "User@Example.com")
+		assert.NoError(t, err)
+		delays = append(delays, d)
+	}
+	assert.Equal(t, []time.Duration{0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute}, delays)
+
+	locked, _ := lockout.Locked(ctx, "user@example.com")
+	assert.True(t, locked > time.Minute)
+
+	lockout.Succeed(ctx, "user@example.com")
+	locked, _ = lockout.Locked(ctx, "user@example.com")
+	assert.Zero(t, locked)
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Counter counts hits in a fixed window that ends at ResetAt.
+type Counter struct {
+	Count   int
+	ResetAt time.Time
+}
+
+// Store keeps counters by key. Counters whose window is over count as
+// missing.
+type Store interface {
+	// Increment adds a hit, starting a new window of the given length when
+	// the previous one is over, and returns the updated counter.
+	Increment(ctx context.Context, key string, window time.Duration) (Counter, error)
+	Get(ctx context.Context, key string) (Counter, error)
+	Set(ctx context.Context, key string, counter Counter) error
+	Delete(ctx context.Context, key string) error
+	// Cleanup drops counters whose window is over.
+	Cleanup(ctx context.Context) error
+}
+
+// Default is the store used by the middleware. It is in memory unless
+// Connect selects Postgres.
+var Default Store = NewMemory()
+
+// Connect selects the store from RATE_LIMIT_STORE: "memory" (the default,
+// per process) or "postgres" (shared by all instances).
+func Connect(db *gorm.DB) {
+	switch strings.ToLower(os.Getenv("RATE_LIMIT_STORE")) {
+	case "", "memory":
+		Default = NewMemory()
+	case "postgres":
+		Default = NewPostgres(db)
+		log.Printf("Rate limits: stored in Postgres")
+	default:
+		log.Fatalf("Unknown RATE_LIMIT_STORE %q", os.Getenv("RATE_LIMIT_STORE"))
+	}
+}
+
+// CleanupJob is a jobs.Every function for the default store.
+func CleanupJob() error {
+	return Default.Cleanup(context.Background())
+}
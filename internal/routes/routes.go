@@ -1,62 +1,141 @@
 package routes
 
 import (
+	"time"
+
 	"spendwise-backend/internal/handlers"
 	"spendwise-backend/internal/middleware"
+	"spendwise-backend/internal/models"
+	"spendwise-backend/internal/ratelimit"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 func SetupRoutes(app *fiber.App) {
-	api := app.Group("/api")
+	// Avatars, served from the storage backend
+	app.Get("/uploads/*", handlers.ServeUpload)
+
+	// Limits for groups other than auth are off unless configured, e.g.
+	// RATE_LIMIT_API=600/1m
+	api := app.Group("/api", middleware.RateLimit("api", ratelimit.Limit{}, ratelimit.Limit{}))
+
+	// Signed links to attachments and slips (the signature replaces the token)
+	api.Get("/files/:kind/:id", handlers.ServeSignedFile)
 
 	// Health check endpoint (no authentication required)
 	api.Get("/health", handlers.HealthCheck)
 
 	// Auth
-	auth := api.Group("/auth")
+	auth := api.Group("/auth", middleware.RateLimit("auth",
+		ratelimit.Limit{Requests: 30, Window: time.Minute},
+		ratelimit.Limit{Requests: 10, Window: time.Minute}))
 	auth.Post("/signup", handlers.Signup)
 	auth.Post("/login", handlers.Login)
+	auth.Post("/login/2fa", handlers.LoginTwoFactor)
+	auth.Get("/oidc/providers", handlers.ListIdentityProviders)
+	auth.Get("/oidc/:provider/login", handlers.StartOIDCLogin)
+	auth.Get("/oidc/:provider/callback", handlers.OIDCCallback)
+	auth.Post("/refresh", handlers.RefreshToken)
+	auth.Post("/logout", handlers.Logout)
+	auth.Post("/forgot-password", handlers.ForgotPassword)
+	auth.Post("/reset-password", handlers.ResetPassword)
+	auth.Post("/verify-email", handlers.VerifyEmail)
+	auth.Post("/verify-email/resend", middleware.Protected(), handlers.ResendVerificationEmail)
 	auth.Get("/me", middleware.Protected(), handlers.GetMe)
+	auth.Delete("/me", middleware.Protected(), handlers.DeleteAccount)
+	auth.Get("/export", middleware.Protected(), handlers.ExportAccount)
 	auth.Put("/profile", middleware.Protected(), handlers.UpdateProfile)
 	auth.Post("/change-password", middleware.Protected(), handlers.ChangePassword)
 	auth.Post("/avatar", middleware.Protected(), handlers.UploadAvatar)
+	auth.Get("/sessions", middleware.Protected(), handlers.ListSessions)
+	auth.Delete("/sessions", middleware.Protected(), handlers.RevokeOtherSessions)
+	auth.Delete("/sessions/:id", middleware.Protected(), handlers.RevokeSession)
+	auth.Post("/2fa/enroll", middleware.Protected(), handlers.EnrollTwoFactor)
+	auth.Post("/2fa/verify", middleware.Protected(), handlers.ConfirmTwoFactor)
+	auth.Post("/2fa/recovery-codes", middleware.Protected(), handlers.RegenerateRecoveryCodes)
+	auth.Post("/2fa/disable", middleware.Protected(), handlers.DisableTwoFactor)
+	auth.Get("/api-keys", middleware.Protected(), handlers.ListAPIKeys)
+	auth.Post("/api-keys", middleware.Protected(), handlers.CreateAPIKey)
+	auth.Delete("/api-keys/:id", middleware.Protected(), handlers.RevokeAPIKey)
 
 	// Wallet
-	wallet := api.Group("/wallet", middleware.Protected())
+	wallet := api.Group("/wallet", middleware.Protected(), middleware.RateLimit("wallet", ratelimit.Limit{}, ratelimit.Limit{}))
 	wallet.Get("/", handlers.GetWallet)
-	wallet.Post("/topup", handlers.TopupWallet)
+	wallet.Post("/topup", middleware.Verified(), handlers.TopupWallet)
 	wallet.Get("/transactions", handlers.GetWalletTransactions)
 
 	// Groups
-	groups := api.Group("/groups", middleware.Protected())
+	groups := api.Group("/groups", middleware.Protected(), middleware.RateLimit("groups", ratelimit.Limit{}, ratelimit.Limit{}))
 	groups.Get("/invite/:code", handlers.GetGroupInfoByInvite)
 	groups.Post("/", handlers.CreateGroup)
 	groups.Get("/", handlers.ListGroups)
-	groups.Post("/join", handlers.JoinGroup)
+	groups.Post("/join", middleware.Verified(), handlers.JoinGroup)
 	groups.Get("/:id", handlers.GetGroup)
-	groups.Put("/:id", handlers.UpdateGroup)
+	groups.Put("/:id", handlers.RequireGroupTwoFactor, handlers.UpdateGroup)
 	groups.Get("/:id/members", handlers.GetGroupMembers)
-	groups.Delete("/:id/members/:userId", handlers.RemoveMember)
+	groups.Delete("/:id/members/:userId", handlers.RequireGroupTwoFactor, handlers.RemoveMember)
+	groups.Get("/:id/categories", handlers.ListCategories)
+	groups.Post("/:id/categories", handlers.RequireGroupTwoFactor, handlers.CreateCategory)
+	groups.Put("/:id/categories/:categoryId", handlers.RequireGroupTwoFactor, handlers.UpdateCategory)
+	groups.Post("/:id/categories/:categoryId/merge", handlers.RequireGroupTwoFactor, handlers.MergeCategory)
+	groups.Get("/:id/fields", handlers.ListCustomFields)
+	groups.Post("/:id/fields", handlers.RequireGroupTwoFactor, handlers.CreateCustomField)
+	groups.Put("/:id/fields/:fieldId", handlers.RequireGroupTwoFactor, handlers.UpdateCustomField)
+	groups.Get("/:id/tags", handlers.ListGroupTags)
+	groups.Get("/:id/settle-up", handlers.GetSettleUp)
+	groups.Get("/:id/settlements", handlers.ListSettlements)
+	groups.Post("/:id/settlements", handlers.CreateSettlement)
+	groups.Get("/:id/budgets", handlers.ListBudgets)
+	groups.Post("/:id/budgets", handlers.RequireGroupTwoFactor, handlers.CreateBudget)
+	groups.Put("/:id/budgets/:budgetId", handlers.RequireGroupTwoFactor, handlers.UpdateBudget)
+	groups.Delete("/:id/budgets/:budgetId", handlers.RequireGroupTwoFactor, handlers.DeleteBudget)
 
-	// Expenses
-	expenses := api.Group("/expenses", middleware.Protected())
+	// Expenses (API keys with the expenses scopes work here, as on approvals)
+	expenses := api.Group("/expenses", middleware.Protected(middleware.APIKeyScopes{
+		fiber.MethodGet:  models.ScopeExpensesRead,
+		fiber.MethodPost: models.ScopeExpensesWrite,
+	}), middleware.RateLimit("expenses", ratelimit.Limit{}, ratelimit.Limit{}))
 	expenses.Post("/", handlers.CreateExpense)
 	expenses.Get("/", handlers.ListExpenses)
 	expenses.Get("/:id", handlers.GetExpense)
+	expenses.Put("/:id/split", handlers.UpdateExpenseSplit)
+	expenses.Get("/:id/attachments", handlers.ListAttachments)
 	expenses.Get("/", handlers.ListExpenses)
 	expenses.Post("/", handlers.CreateExpense)
 
+	// Recurring Expenses
+	recurring := api.Group("/recurring-expenses", middleware.Protected())
+	recurring.Post("/", handlers.CreateRecurringExpense)
+	recurring.Get("/", handlers.ListRecurringExpenses)
+	recurring.Put("/:id", handlers.UpdateRecurringExpense)
+	recurring.Delete("/:id", handlers.DeleteRecurringExpense)
+
 	// Storage
 	storage := api.Group("/storage", middleware.Protected())
 	storage.Post("/upload", handlers.UploadAttachment)
+	storage.Get("/attachments/:id/extraction", handlers.GetAttachmentExtraction)
+	storage.Get("/attachments/:id/download", handlers.DownloadAttachment)
+	storage.Get("/attachments/:id/thumbnail", handlers.DownloadAttachmentThumbnail)
+	storage.Put("/attachments/:id", handlers.ReplaceAttachment)
+	storage.Delete("/attachments/:id", handlers.DeleteAttachment)
+	storage.Get("/slips/:id/download", handlers.DownloadSlip)
+	storage.Get("/:kind/:id/signed-url", handlers.GetSignedFileURL)
 
 	// Approvals
-	approvals := api.Group("/approvals", middleware.Protected())
+	approvals := api.Group("/approvals", middleware.Protected(middleware.APIKeyScopes{
+		fiber.MethodGet:  models.ScopeApprovals,
+		fiber.MethodPost: models.ScopeApprovals,
+	}))
 	approvals.Get("/", handlers.ListApprovals)
 	approvals.Post("/:id/approve", handlers.ApproveExpense)
 	approvals.Post("/:id/reject", handlers.RejectExpense)
 
+	// Approval Delegations
+	delegations := api.Group("/delegations", middleware.Protected())
+	delegations.Post("/", handlers.CreateDelegation)
+	delegations.Get("/", handlers.ListDelegations)
+	delegations.Delete("/:id", handlers.DeleteDelegation)
+
 	// Dashboard
 	dashboard := api.Group("/dashboard", middleware.Protected())
 	dashboard.Get("/stats", handlers.GetDashboardStats)
@@ -0,0 +1,109 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Outbox is the mailer used by the handlers, set up by Connect.
+var Outbox Mailer
+
+// Connect selects the mailer from MAIL_DRIVER: "smtp", "file" (one .eml per
+// message in MAIL_DIR) or "console". There is no default, so a server never
+// silently keeps its mail to itself; file and console are for development.
+func Connect() {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "SpendWise <no-reply@spendwise.local>"
+	}
+
+	switch strings.ToLower(os.Getenv("MAIL_DRIVER")) {
+	case "":
+		log.Fatal(`MAIL_DRIVER is not set: use "smtp", or "file" or "console" in development`)
+	case "console":
+		Outbox = &Console{From: from, W: os.Stdout}
+		log.Printf("Mail: printed to the console with links redacted")
+	case "file":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "./mail"
+		}
+		Outbox = &File{From: from, Dir: dir}
+		log.Printf("Mail: written to %s", dir)
+	case "smtp":
+		smtp, err := NewSMTPFromEnv(from)
+		if err != nil {
+			log.Fatal("Failed to configure SMTP. \n", err)
+		}
+		Outbox = smtp
+		log.Printf("Mail: SMTP via %s", smtp.Addr)
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q", os.Getenv("MAIL_DRIVER"))
+	}
+}
+
+var ErrInvalidHeader = errors.New("invalid mail header")
+
+// Build renders a message as RFC 5322 text.
+func Build(from string, msg Message, now time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("%w: recipient %q", ErrInvalidHeader, msg.To)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") || strings.ContainsAny(from, "\r\n") {
+		return nil, ErrInvalidHeader
+	}
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "localhost"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Text, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes(), nil
+}
+
+// envelopeAddress returns the bare address of a header such as
+// "Name <a@b.c>".
+func envelopeAddress(header string) (string, error) {
+	addr, err := mail.ParseAddress(header)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidHeader, header)
+	}
+	return addr.Address, nil
+}
@@ -0,0 +1,63 @@
+package mail
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	data, err := Build("SpendWise <no-reply@example.com>", Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Text:    "Line one\nLine two",
+	}, now)
+	assert.NoError(t, err)
+
+	text := string(data)
+	assert.Contains(t, text, "To: user@example.com\r\n")
+	assert.Contains(t, text, "Subject: Reset your password\r\n")
+	assert.Contains(t, text, "Date: Fri, 01 Mar 2024 09:30:00 +0000\r\n")
+	assert.Contains(t, text, "@example.com>\r\n")
+	assert.True(t, strings.HasSuffix(text, "\r\n\r\nLine one\r\nLine two"))
+}
+
+func TestBuildRejectsHeaderInjection(t *testing.T) {
+	_, err := Build("a@example.com", Message{To: "user@example.com\r\nBcc: x@evil.test", Subject: "Hi"}, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+
+	_, err = Build("a@example.com", Message{To: "user@example.com", Subject: "Hi\r\nBcc: x@evil.test"}, time.Now())
+	assert.ErrorIs(t, err, ErrInvalidHeader)
+}
+
+func TestFileSink(t *testing.T) {
+	dir := t.TempDir()
+	sink := &File{From: "a@example.com", Dir: dir}
+
+	assert.NoError(t, sink.Send(context.Background(), Message{To: "user@example.com", Subject: "Hi", Text: "Hello"}))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if assert.Len(t, files, 1) {
+		data, _ := os.ReadFile(files[0])
+		assert.Contains(t, string(data), "Hello")
+	}
+}
+
+func TestConsoleRedactsLinks(t *testing.T) {
+	var out strings.Builder
+	sink := &Console{From: "a@example.com", W: &out}
+
+	assert.NoError(t, sink.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Text:    "Open https://app.example.com/reset-password?token=secret123 to continue.",
+	}))
+	assert.NotContains(t, out.String(), "secret123")
+	assert.Contains(t, out.String(), "https://app.example.com/reset-password?[redacted] to continue.")
+}
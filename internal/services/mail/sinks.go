@@ -0,0 +1,83 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// linkQuery matches the query of a link, where the tokens are.
+var linkQuery = regexp.MustCompile(`(https?://[^\s?]*\?)\S+`)
+
+// Console prints messages instead of sending them. Link queries are
+// redacted since logs are read more widely than mailboxes; use File to
+// follow links.
+type Console struct {
+	From string
+	W    io.Writer
+
+	mu sync.Mutex
+}
+
+func (c *Console) Send(ctx context.Context, msg Message) error {
+	data, err := Build(c.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data = linkQuery.ReplaceAll(data, []byte("${1}[redacted]"))
+	_, err = fmt.Fprintf(c.W, "----- mail -----\n%s\n----- end -----\n", data)
+	return err
+}
+
+// File writes every message to its own .eml file in Dir.
+type File struct {
+	From string
+	Dir  string
+}
+
+func (f *File) Send(ctx context.Context, msg Message) error {
+	data, err := Build(f.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0755); err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(f.Dir, time.Now().Format("20060102-150405")+"-*.eml")
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(data); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Memory keeps messages in memory, for tests.
+type Memory struct {
+	mu   sync.Mutex
+	Sent []Message
+}
+
+func (m *Memory) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Sent = append(m.Sent, msg)
+	return nil
+}
+
+// Messages returns a copy of everything sent so far.
+func (m *Memory) Messages() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.Sent...)
+}
@@ -0,0 +1,72 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+// SMTP sends through a mail server. smtp.SendMail upgrades to TLS with
+// STARTTLS when the server offers it.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// NewSMTPFromEnv reads SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME
+// and SMTP_PASSWORD.
+func NewSMTPFromEnv(from string) (*SMTP, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, fmt.Errorf("SMTP_HOST is required")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	if _, err := envelopeAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+	return &SMTP{
+		Addr:     net.JoinHostPort(host, port),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     from,
+	}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	data, err := Build(s.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := envelopeAddress(s.From)
+	if err != nil {
+		return err
+	}
+	to, err := envelopeAddress(msg.To)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, _ := net.SplitHostPort(s.Addr)
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	// net/smtp takes no context; give up waiting on it instead
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, auth, from, []string{to}, data) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
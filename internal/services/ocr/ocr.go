@@ -0,0 +1,64 @@
+package ocr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned for files an engine cannot read (e.g. PDFs for
+// an image-only engine).
+var ErrUnsupported = errors.New("file type not supported by OCR engine")
+
+// Engine turns a receipt image into text. Confidence is the engine's own
+// recognition confidence in the range 0-1.
+type Engine interface {
+	Name() string
+	Recognize(ctx context.Context, filePath, contentType string) (text string, confidence float64, err error)
+}
+
+// Receipt holds the fields extracted from a receipt. Nil fields could not be
+// found.
+type Receipt struct {
+	Merchant        string             `json:"merchant"`
+	Total           *float64           `json:"total"`
+	Tax             *float64           `json:"tax"`
+	Date            *time.Time         `json:"date"`
+	Confidence      float64            `json:"confidence"`       // Overall 0-1
+	FieldConfidence map[string]float64 `json:"field_confidence"` // Per field 0-1
+	Text            string             `json:"-"`
+}
+
+// Extract runs the engine on a file and parses the recognized text.
+func Extract(ctx context.Context, engine Engine, filePath, contentType string) (*Receipt, error) {
+	text, ocrConfidence, err := engine.Recognize(ctx, filePath, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt := Parse(text)
+	receipt.Confidence *= ocrConfidence
+	for field, c := range receipt.FieldConfidence {
+		receipt.FieldConfidence[field] = c * ocrConfidence
+	}
+	return receipt, nil
+}
+
+// Default returns the engine selected by OCR_ENGINE ("tesseract" or "none").
+// When unset, the local Tesseract engine is used if it is installed.
+func Default() Engine {
+	switch strings.ToLower(os.Getenv("OCR_ENGINE")) {
+	case "none", "off", "disabled":
+		return nil
+	case "tesseract":
+		return NewTesseract()
+	}
+
+	if _, err := exec.LookPath(tesseractBinary()); err == nil {
+		return NewTesseract()
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package ocr
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	amountPattern = regexp.MustCompile(`(\d{1,3}(?:,\d{3})+|\d+)\.(\d{2})\b`)
+	totalPattern  = regexp.MustCompile(`(?i)(grand\s*total|total\s*amount|amount\s*due|balance\s*due|net\s*total|\btotal\b|ยอดรวม|รวมทั้งสิ้น|ยอดสุทธิ|สุทธิ)`)
+	subtotalLine  = regexp.MustCompile(`(?i)(sub\s*-?\s*total|before\s*tax|excl)`)
+	taxPattern    = regexp.MustCompile(`(?i)(\bvat\b|\btax\b|ภาษี)`)
+	ignoredLine   = regexp.MustCompile(`(?i)(receipt|invoice|ใบเสร็จ|ใบกำกับ|tel|phone|www\.|http|tax\s*id|เลขประจำตัว)`)
+
+	numericDate = regexp.MustCompile(`\b(\d{1,2})[/.-](\d{1,2})[/.-](\d{2,4})\b`)
+	isoDate     = regexp.MustCompile(`\b(\d{4})-(\d{2})-(\d{2})\b`)
+	textDate    = regexp.MustCompile(`(?i)\b(\d{1,2})\s+(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?\s+(\d{2,4})\b`)
+)
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// Parse pulls merchant, total, tax and date out of recognized receipt text
+// using simple line heuristics. Confidence reflects how sure each heuristic
+// was, before the OCR engine's own confidence is applied.
+func Parse(text string) *Receipt {
+	receipt := &Receipt{FieldConfidence: map[string]float64{}, Text: text}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	parseMerchant(receipt, lines)
+	parseTotal(receipt, lines)
+	parseTax(receipt, lines)
+	parseDate(receipt, lines)
+
+	// Weighted by how useful each field is for prefilling an expense
+	weights := map[string]float64{"total": 0.4, "date": 0.25, "merchant": 0.2, "tax": 0.15}
+	for field, w := range weights {
+		receipt.Confidence += w * receipt.FieldConfidence[field]
+	}
+	return receipt
+}
+
+func parseMerchant(r *Receipt, lines []string) {
+	// The merchant name is usually one of the first lines with letters
+	for i, line := range lines {
+		if i >= 5 {
+			break
+		}
+		if ignoredLine.MatchString(line) || amountPattern.MatchString(line) || findDate(line) != nil {
+			continue
+		}
+		letters := 0
+		for _, ch := range line {
+			if ch > '9' {
+				letters++
+			}
+		}
+		if letters < 3 {
+			continue
+		}
+		r.Merchant = line
+		r.FieldConfidence["merchant"] = 0.9 - 0.15*float64(i)
+		return
+	}
+}
+
+func lastAmount(line string) (float64, bool) {
+	matches := amountPattern.FindAllStringSubmatch(line, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	m := matches[len(matches)-1]
+	v, err := strconv.ParseFloat(strings.ReplaceAll(m[1], ",", "")+"."+m[2], 64)
+	return v, err == nil
+}
+
+func parseTotal(r *Receipt, lines []string) {
+	// Prefer the last "total" line that is not a subtotal
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if !totalPattern.MatchString(line) || subtotalLine.MatchString(line) {
+			continue
+		}
+		if v, ok := lastAmount(line); ok {
+			r.Total = &v
+			r.FieldConfidence["total"] = 0.95
+			return
+		}
+		// Amount printed on the next line
+		if i+1 < len(lines) {
+			if v, ok := lastAmount(lines[i+1]); ok {
+				r.Total = &v
+				r.FieldConfidence["total"] = 0.8
+				return
+			}
+		}
+	}
+
+	// Fall back to the largest amount on the receipt
+	var best float64
+	for _, line := range lines {
+		if v, ok := lastAmount(line); ok && v > best {
+			best = v
+		}
+	}
+	if best > 0 {
+		r.Total = &best
+		r.FieldConfidence["total"] = 0.5
+	}
+}
+
+func parseTax(r *Receipt, lines []string) {
+	for _, line := range lines {
+		if !taxPattern.MatchString(line) || totalPattern.MatchString(line) {
+			continue
+		}
+		// Skip "VAT 7%" style rates without an amount
+		if v, ok := lastAmount(line); ok {
+			r.Tax = &v
+			r.FieldConfidence["tax"] = 0.85
+			if r.Total != nil && v >= *r.Total {
+				r.FieldConfidence["tax"] = 0.3
+			}
+			return
+		}
+	}
+}
+
+func parseDate(r *Receipt, lines []string) {
+	for _, line := range lines {
+		if d := findDate(line); d != nil {
+			r.Date = d
+			r.FieldConfidence["date"] = 0.85
+			return
+		}
+	}
+}
+
+func findDate(line string) *time.Time {
+	if m := isoDate.FindStringSubmatch(line); m != nil {
+		return makeDate(m[1], m[2], m[3])
+	}
+	// Receipts here are day-first
+	if m := numericDate.FindStringSubmatch(line); m != nil {
+		return makeDate(m[3], m[2], m[1])
+	}
+	if m := textDate.FindStringSubmatch(line); m != nil {
+		month := months[strings.ToLower(m[2][:3])]
+		return makeDate(m[3], strconv.Itoa(int(month)), m[1])
+	}
+	return nil
+}
+
+func makeDate(y, m, d string) *time.Time {
+	year, _ := strconv.Atoi(y)
+	month, _ := strconv.Atoi(m)
+	day, _ := strconv.Atoi(d)
+
+	switch {
+	case year < 100:
+		year += 2000
+	case year > 2400:
+		year -= 543 // Thai Buddhist calendar
+	}
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return nil
+	}
+
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local)
+	if t.Day() != day {
+		return nil // E.g. 31/02
+	}
+	return &t
+}
@@ -0,0 +1,66 @@
+package ocr
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("English receipt", func(t *testing.T) {
+		r := Parse(`RECEIPT
+Blue Elephant Cafe
+123 Sukhumvit Rd
+Date: 14/03/2025 12:41
+Pad Thai          120.00
+Iced Tea           45.00
+Subtotal          165.00
+VAT 7%             11.55
+TOTAL             176.55
+Thank you`)
+
+		assert.Equal(t, "Blue Elephant Cafe", r.Merchant)
+		if assert.NotNil(t, r.Total) {
+			assert.Equal(t, 176.55, *r.Total)
+		}
+		if assert.NotNil(t, r.Tax) {
+			assert.Equal(t, 11.55, *r.Tax)
+		}
+		if assert.NotNil(t, r.Date) {
+			assert.Equal(t, time.March, r.Date.Month())
+			assert.Equal(t, 14, r.Date.Day())
+			assert.Equal(t, 2025, r.Date.Year())
+		}
+		assert.InDelta(t, 0.9, r.Confidence, 0.1)
+	})
+
+	t.Run("Thai Buddhist year and thousands separator", func(t *testing.T) {
+		r := Parse(`ร้านกาแฟดี
+05/01/2568
+รวมทั้งสิ้น 1,250.00`)
+
+		if assert.NotNil(t, r.Total) {
+			assert.Equal(t, 1250.0, *r.Total)
+		}
+		if assert.NotNil(t, r.Date) {
+			assert.Equal(t, 2025, r.Date.Year())
+		}
+		assert.Nil(t, r.Tax)
+	})
+
+	t.Run("Falls back to largest amount", func(t *testing.T) {
+		r := Parse("Shop\n10.00\n25.50\n3.00")
+		if assert.NotNil(t, r.Total) {
+			assert.Equal(t, 25.5, *r.Total)
+		}
+		assert.Equal(t, 0.5, r.FieldConfidence["total"])
+	})
+
+	t.Run("Nothing found", func(t *testing.T) {
+		r := Parse("")
+		assert.Nil(t, r.Total)
+		assert.Nil(t, r.Date)
+		assert.Equal(t, 0.0, r.Confidence)
+	})
+}
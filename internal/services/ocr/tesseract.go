@@ -0,0 +1,99 @@
+package ocr
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Tesseract runs the local tesseract CLI, so receipts never leave the
+// server and no network access is needed.
+type Tesseract struct {
+	Binary    string
+	Languages string // E.g. "eng+tha"
+}
+
+func NewTesseract() *Tesseract {
+	langs := os.Getenv("OCR_LANGUAGES")
+	if langs == "" {
+		langs = "eng"
+	}
+	return &Tesseract{Binary: tesseractBinary(), Languages: langs}
+}
+
+func tesseractBinary() string {
+	if bin := os.Getenv("TESSERACT_PATH"); bin != "" {
+		return bin
+	}
+	return "tesseract"
+}
+
+func (t *Tesseract) Name() string {
+	return "tesseract"
+}
+
+func (t *Tesseract) Recognize(ctx context.Context, filePath, contentType string) (string, float64, error) {
+	if contentType != "" && !strings.HasPrefix(contentType, "image/") {
+		return "", 0, ErrUnsupported
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.Binary, filePath, "stdout", "-l", t.Languages, "tsv")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", 0, fmt.Errorf("tesseract: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	text, confidence := parseTSV(stdout.Bytes())
+	return text, confidence, nil
+}
+
+// parseTSV rebuilds the text line by line from tesseract's TSV output and
+// averages the per-word confidence.
+func parseTSV(data []byte) (string, float64) {
+	var lines []string
+	var current []string
+	currentKey := ""
+	var confSum float64
+	var words int
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		cols := strings.Split(scanner.Text(), "\t")
+		// level page block par line word left top width height conf text
+		if len(cols) < 12 || cols[0] != "5" {
+			continue
+		}
+		word := strings.TrimSpace(cols[11])
+		if word == "" {
+			continue
+		}
+
+		key := strings.Join(cols[1:5], "-")
+		if key != currentKey && len(current) > 0 {
+			lines = append(lines, strings.Join(current, " "))
+			current = nil
+		}
+		currentKey = key
+		current = append(current, word)
+
+		if conf, err := strconv.ParseFloat(cols[10], 64); err == nil && conf >= 0 {
+			confSum += conf
+			words++
+		}
+	}
+	if len(current) > 0 {
+		lines = append(lines, strings.Join(current, " "))
+	}
+
+	if words == 0 {
+		return strings.Join(lines, "\n"), 0
+	}
+	return strings.Join(lines, "\n"), confSum / float64(words) / 100
+}
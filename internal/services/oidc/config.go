@@ -0,0 +1,43 @@
+package oidc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ProvidersFromEnv reads the providers named in OIDC_PROVIDERS (comma
+// separated). Each name has OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and optionally _SCOPES (space separated) and
+// _DISPLAY_NAME. baseURL is used for the default redirect URL.
+func ProvidersFromEnv(baseURL string) (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := &Provider{
+			Name:         name,
+			DisplayName:  os.Getenv(prefix + "DISPLAY_NAME"),
+			Issuer:       strings.TrimSpace(os.Getenv(prefix + "ISSUER")),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(os.Getenv(prefix + "SCOPES")),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = name
+		}
+		if p.RedirectURL == "" {
+			p.RedirectURL = strings.TrimSuffix(baseURL, "/") + "/api/auth/oidc/" + name + "/callback"
+		}
+		providers[name] = p
+	}
+	return providers, nil
+}
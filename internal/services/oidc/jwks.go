@@ -0,0 +1,139 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// keySet caches the provider's signing keys by key ID.
+type keySet struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// key returns the public key with the given ID. Unknown IDs trigger a
+// refetch, at most once a minute, since providers rotate keys.
+func (p *Provider) key(ctx context.Context, jwksURI, kid string) (interface{}, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	if keys != nil {
+		if key, ok := lookupKey(keys, kid); ok {
+			return key, nil
+		}
+		if time.Since(keys.fetchedAt) < time.Minute {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+	}
+
+	fetched, err := p.fetchKeys(ctx, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = fetched
+	p.mu.Unlock()
+
+	if key, ok := lookupKey(fetched, kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a key by ID; tokens without an ID match a sole key.
+func lookupKey(keys *keySet, kid string) (interface{}, bool) {
+	if kid == "" && len(keys.keys) == 1 {
+		for _, key := range keys.keys {
+			return key, true
+		}
+	}
+	key, ok := keys.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) fetchKeys(ctx context.Context, jwksURI string) (*keySet, error) {
+	var doc struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, jwksURI, &doc); err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+
+	set := &keySet{keys: map[string]interface{}{}, fetchedAt: time.Now()}
+	for _, jwk := range doc.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseKey(jwk)
+		if err != nil {
+			continue // Skip key types we do not support
+		}
+		set.keys[jwk.Kid] = key
+	}
+	return set, nil
+}
+
+func parseKey(jwk jsonWebKey) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, fmt.Errorf("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
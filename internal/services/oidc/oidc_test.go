@@ -0,0 +1,166 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockIssuer is a minimal OIDC provider: discovery, JWKS and a token
+// endpoint that checks the PKCE verifier.
+type mockIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string // Sent to the authorization endpoint
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	m := &mockIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || Challenge(r.Form.Get("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := jwt.MapClaims{
+			"iss":            m.URL,
+			"aud":            "client-1",
+			"sub":            "user-42",
+			"email":          "staff@example.com",
+			"email_verified": true,
+			"name":           "Staff Member",
+			"nonce":          m.nonce,
+			"iat":            time.Now().Unix(),
+			"exp":            time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test-key"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p := &Provider{Name: "mock", Issuer: issuer.URL, ClientID: "client-1", ClientSecret: "secret", RedirectURL: "http://app/callback"}
+	ctx := context.Background()
+
+	verifier, nonce := RandomString(), RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	assert.NoError(t, err)
+
+	u, _ := url.Parse(authURL)
+	assert.Equal(t, "/authorize", u.Path)
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.Equal(t, "state-1", u.Query().Get("state"))
+	issuer.challenge = u.Query().Get("code_challenge")
+	issuer.nonce = u.Query().Get("nonce")
+
+	claims, err := p.Exchange(ctx, "good-code", verifier, nonce)
+	assert.NoError(t, err)
+	if assert.NotNil(t, claims) {
+		assert.Equal(t, "user-42", claims.Subject)
+		assert.Equal(t, "staff@example.com", claims.Email)
+		assert.True(t, claims.EmailVerified)
+	}
+
+	t.Run("Wrong Verifier", func(t *testing.T) {
+		_, err := p.Exchange(ctx, "good-code", RandomString(), nonce)
+		assert.Error(t, err)
+	})
+
+	t.Run("Wrong Nonce", func(t *testing.T) {
+		_, err := p.Exchange(ctx, "good-code", verifier, "other-nonce")
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("Wrong Audience", func(t *testing.T) {
+		issuer.claims = jwt.MapClaims{"aud": "someone-else"}
+		defer func() { issuer.claims = nil }()
+		_, err := p.Exchange(ctx, "good-code", verifier, nonce)
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		issuer.claims = jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}
+		defer func() { issuer.claims = nil }()
+		_, err := p.Exchange(ctx, "good-code", verifier, nonce)
+		assert.ErrorIs(t, err, ErrInvalidIDToken)
+	})
+}
+
+func TestVerifyRejectsForeignKey(t *testing.T) {
+	issuer := newMockIssuer(t)
+	p := &Provider{Name: "mock", Issuer: issuer.URL, ClientID: "client-1"}
+
+	other, _ := rsa.GenerateKey(rand.Reader, 2048)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": issuer.URL, "aud": "client-1", "sub": "x", "nonce": "n",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = "test-key"
+	signed, _ := token.SignedString(other)
+
+	_, err := p.VerifyIDToken(context.Background(), signed, "n")
+	assert.ErrorIs(t, err, ErrInvalidIDToken)
+}
+
+func TestProvidersFromEnv(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "corp, google")
+	t.Setenv("OIDC_CORP_ISSUER", "https://id.example.com")
+	t.Setenv("OIDC_CORP_CLIENT_ID", "spendwise")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "abc")
+	t.Setenv("OIDC_GOOGLE_DISPLAY_NAME", "Google")
+
+	providers, err := ProvidersFromEnv("https://api.example.com")
+	assert.NoError(t, err)
+	assert.Len(t, providers, 2)
+	assert.Equal(t, "https://api.example.com/api/auth/oidc/corp/callback", providers["corp"].RedirectURL)
+	assert.Equal(t, "Google", providers["google"].DisplayName)
+
+	t.Setenv("OIDC_CORP_CLIENT_ID", "")
+	_, err = ProvidersFromEnv("https://api.example.com")
+	assert.Error(t, err)
+}
@@ -0,0 +1,217 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Monthly = "monthly"
+	Weekly  = "weekly"
+	Cron    = "cron"
+)
+
+// Schedule describes when a recurring expense fires. Monthly and weekly
+// schedules fire at Hour:Minute on DayOfMonth / Weekday; cron schedules use a
+// standard five-field expression ("minute hour day-of-month month day-of-week").
+type Schedule struct {
+	Frequency  string
+	DayOfMonth int          // 1-31, clamped to the last day of shorter months
+	Weekday    time.Weekday // 0 = Sunday
+	Hour       int
+	Minute     int
+	CronExpr   string
+}
+
+// Validate reports whether the schedule can produce occurrences.
+func (s Schedule) Validate() error {
+	if s.Hour < 0 || s.Hour > 23 || s.Minute < 0 || s.Minute > 59 {
+		return fmt.Errorf("invalid time of day %02d:%02d", s.Hour, s.Minute)
+	}
+
+	switch s.Frequency {
+	case Monthly:
+		if s.DayOfMonth < 1 || s.DayOfMonth > 31 {
+			return fmt.Errorf("day_of_month must be between 1 and 31")
+		}
+	case Weekly:
+		if s.Weekday < time.Sunday || s.Weekday > time.Saturday {
+			return fmt.Errorf("weekday must be between 0 and 6")
+		}
+	case Cron:
+		if _, err := parseCron(s.CronExpr); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown frequency %q", s.Frequency)
+	}
+	return nil
+}
+
+// Next returns the first occurrence strictly after t, in t's location.
+func (s Schedule) Next(t time.Time) (time.Time, error) {
+	if err := s.Validate(); err != nil {
+		return time.Time{}, err
+	}
+
+	switch s.Frequency {
+	case Monthly:
+		return s.nextMonthly(t), nil
+	case Weekly:
+		return s.nextWeekly(t), nil
+	default:
+		expr, _ := parseCron(s.CronExpr)
+		return expr.next(t)
+	}
+}
+
+func (s Schedule) nextMonthly(t time.Time) time.Time {
+	year, month, _ := t.Date()
+	for {
+		day := s.DayOfMonth
+		if last := daysIn(year, month); day > last {
+			day = last
+		}
+		candidate := time.Date(year, month, day, s.Hour, s.Minute, 0, 0, t.Location())
+		if candidate.After(t) {
+			return candidate
+		}
+		month++
+		if month > time.December {
+			month = time.January
+			year++
+		}
+	}
+}
+
+func (s Schedule) nextWeekly(t time.Time) time.Time {
+	year, month, day := t.Date()
+	candidate := time.Date(year, month, day, s.Hour, s.Minute, 0, 0, t.Location())
+	for candidate.Weekday() != s.Weekday || !candidate.After(t) {
+		candidate = candidate.AddDate(0, 0, 1)
+	}
+	return candidate
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func parseCron(expr string) (*cronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	var c cronExpr
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if c.dom, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if c.dow, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// Both 0 and 7 mean Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+	return &c, nil
+}
+
+// parseField turns "*", "5", "1-5", "*/15", "1-10/2" and comma lists of those
+// into a bitset of allowed values.
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(bounds[0])
+			hi, err2 = strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("value out of range in %q", part)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronExpr) dayMatches(t time.Time) bool {
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	// Like Vixie cron: when both fields are restricted, either may match
+	if !c.domAny && !c.dowAny {
+		return domOK || dowOK
+	}
+	return domOK && dowOK
+}
+
+func (c *cronExpr) next(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cron expression never fires")
+}
@@ -0,0 +1,77 @@
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func date(y int, m time.Month, d, hh, mm int) time.Time {
+	return time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+}
+
+func TestMonthly(t *testing.T) {
+	s := Schedule{Frequency: Monthly, DayOfMonth: 31, Hour: 9}
+
+	t.Run("Clamps to last day of month", func(t *testing.T) {
+		next, err := s.Next(date(2025, time.February, 1, 0, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, date(2025, time.February, 28, 9, 0), next)
+	})
+
+	t.Run("Strictly after", func(t *testing.T) {
+		next, err := s.Next(date(2025, time.January, 31, 9, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, date(2025, time.February, 28, 9, 0), next)
+	})
+
+	t.Run("Rolls over year", func(t *testing.T) {
+		next, err := s.Next(date(2025, time.December, 31, 10, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, date(2026, time.January, 31, 9, 0), next)
+	})
+}
+
+func TestWeekly(t *testing.T) {
+	s := Schedule{Frequency: Weekly, Weekday: time.Monday, Hour: 8, Minute: 30}
+
+	// 2025-03-05 is a Wednesday
+	next, err := s.Next(date(2025, time.March, 5, 12, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, date(2025, time.March, 10, 8, 30), next)
+
+	next, err = s.Next(next)
+	assert.NoError(t, err)
+	assert.Equal(t, date(2025, time.March, 17, 8, 30), next)
+}
+
+func TestCron(t *testing.T) {
+	t.Run("First of month at midnight", func(t *testing.T) {
+		s := Schedule{Frequency: Cron, CronExpr: "0 0 1 * *"}
+		next, err := s.Next(date(2025, time.March, 5, 12, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, date(2025, time.April, 1, 0, 0), next)
+	})
+
+	t.Run("Steps and ranges", func(t *testing.T) {
+		s := Schedule{Frequency: Cron, CronExpr: "*/15 9-17 * * 1-5"}
+		// Friday evening rolls to Monday morning
+		next, err := s.Next(date(2025, time.March, 7, 17, 50))
+		assert.NoError(t, err)
+		assert.Equal(t, date(2025, time.March, 10, 9, 0), next)
+	})
+
+	t.Run("Sunday as 7", func(t *testing.T) {
+		s := Schedule{Frequency: Cron, CronExpr: "0 12 * * 7"}
+		next, err := s.Next(date(2025, time.March, 5, 0, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, date(2025, time.March, 9, 12, 0), next)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, expr := range []string{"", "* * *", "60 * * * *", "5-1 * * * *", "*/0 * * * *"} {
+			assert.Error(t, Schedule{Frequency: Cron, CronExpr: expr}.Validate(), expr)
+		}
+	})
+}
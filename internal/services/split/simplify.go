@@ -0,0 +1,69 @@
+package split
+
+import "sort"
+
+// Transfer is one suggested payment that moves a group towards zero balances.
+type Transfer struct {
+	FromUserID uint    `json:"from_user_id"`
+	ToUserID   uint    `json:"to_user_id"`
+	Amount     float64 `json:"amount"`
+}
+
+// Simplify turns net balances (positive: is owed, negative: owes) into a
+// short list of transfers that settles everyone. It repeatedly matches the
+// largest debtor with the largest creditor, which needs at most n-1
+// transfers. Balances are handled in cents; sub-cent residue is ignored.
+func Simplify(nets map[uint]float64) []Transfer {
+	type entry struct {
+		userID uint
+		cents  int64
+	}
+
+	var debtors, creditors []entry
+	for id, net := range nets {
+		cents := toCents(net)
+		switch {
+		case cents < 0:
+			debtors = append(debtors, entry{id, -cents})
+		case cents > 0:
+			creditors = append(creditors, entry{id, cents})
+		}
+	}
+
+	// Largest first; ties broken by user ID so results are stable
+	byAmount := func(list []entry) func(i, j int) bool {
+		return func(i, j int) bool {
+			if list[i].cents != list[j].cents {
+				return list[i].cents > list[j].cents
+			}
+			return list[i].userID < list[j].userID
+		}
+	}
+
+	transfers := make([]Transfer, 0)
+	for len(debtors) > 0 && len(creditors) > 0 {
+		sort.Slice(debtors, byAmount(debtors))
+		sort.Slice(creditors, byAmount(creditors))
+
+		d, c := &debtors[0], &creditors[0]
+		amount := d.cents
+		if c.cents < amount {
+			amount = c.cents
+		}
+		transfers = append(transfers, Transfer{
+			FromUserID: d.userID,
+			ToUserID:   c.userID,
+			Amount:     float64(amount) / 100,
+		})
+
+		d.cents -= amount
+		c.cents -= amount
+		if d.cents == 0 {
+			debtors = debtors[1:]
+		}
+		if c.cents == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
@@ -0,0 +1,133 @@
+package split
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	Equal   = "equal"
+	Exact   = "exact"
+	Percent = "percent"
+	Shares  = "shares"
+)
+
+// Participant is one member taking part in a split. Which of Amount,
+// Percent or Shares is read depends on the split method.
+type Participant struct {
+	UserID  uint    `json:"user_id"`
+	Amount  float64 `json:"amount"`
+	Percent float64 `json:"percent"`
+	Shares  float64 `json:"shares"`
+}
+
+// Compute divides total between participants and returns each one's amount,
+// in participant order. Amounts are rounded to cents; any rounding remainder
+// goes to the first participants so the result always adds up to total.
+func Compute(total float64, method string, participants []Participant) ([]float64, error) {
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("at least one participant is required")
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("amount must be positive")
+	}
+
+	seen := make(map[uint]bool)
+	for _, p := range participants {
+		if seen[p.UserID] {
+			return nil, fmt.Errorf("user %d appears more than once", p.UserID)
+		}
+		seen[p.UserID] = true
+	}
+
+	totalCents := toCents(total)
+	weights := make([]float64, len(participants))
+
+	switch method {
+	case Equal:
+		for i := range weights {
+			weights[i] = 1
+		}
+	case Exact:
+		var sum int64
+		amounts := make([]float64, len(participants))
+		for i, p := range participants {
+			if p.Amount < 0 {
+				return nil, fmt.Errorf("amounts cannot be negative")
+			}
+			sum += toCents(p.Amount)
+			amounts[i] = float64(toCents(p.Amount)) / 100
+		}
+		if sum != totalCents {
+			return nil, fmt.Errorf("amounts add up to %.2f, expected %.2f", float64(sum)/100, total)
+		}
+		return amounts, nil
+	case Percent:
+		var sum float64
+		for i, p := range participants {
+			if p.Percent < 0 {
+				return nil, fmt.Errorf("percentages cannot be negative")
+			}
+			weights[i] = p.Percent
+			sum += p.Percent
+		}
+		if math.Abs(sum-100) > 0.01 {
+			return nil, fmt.Errorf("percentages add up to %.2f, expected 100", sum)
+		}
+	case Shares:
+		for i, p := range participants {
+			if p.Shares < 0 {
+				return nil, fmt.Errorf("shares cannot be negative")
+			}
+			weights[i] = p.Shares
+		}
+	default:
+		return nil, fmt.Errorf("unknown split method %q", method)
+	}
+
+	return distribute(totalCents, weights)
+}
+
+// distribute splits cents proportionally to weights using the largest
+// remainder method.
+func distribute(totalCents int64, weights []float64) ([]float64, error) {
+	var weightSum float64
+	for _, w := range weights {
+		weightSum += w
+	}
+	if weightSum <= 0 {
+		return nil, fmt.Errorf("weights must add up to more than zero")
+	}
+
+	cents := make([]int64, len(weights))
+	remainders := make([]float64, len(weights))
+	var assigned int64
+	for i, w := range weights {
+		exact := float64(totalCents) * w / weightSum
+		cents[i] = int64(math.Floor(exact))
+		remainders[i] = exact - float64(cents[i])
+		assigned += cents[i]
+	}
+
+	// Hand out leftover cents, largest remainder first (ties keep order)
+	for left := totalCents - assigned; left > 0; left-- {
+		best := 0
+		for i := range remainders {
+			if remainders[i] > remainders[best] {
+				best = i
+			}
+		}
+		cents[best]++
+		remainders[best] = -1
+	}
+
+	amounts := make([]float64, len(cents))
+	for i, c := range cents {
+		amounts[i] = float64(c) / 100
+	}
+	return amounts, nil
+}
+
+func toCents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
@@ -0,0 +1,79 @@
+package split
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func users(ids ...uint) []Participant {
+	p := make([]Participant, len(ids))
+	for i, id := range ids {
+		p[i] = Participant{UserID: id}
+	}
+	return p
+}
+
+func TestCompute(t *testing.T) {
+	t.Run("Equal with remainder", func(t *testing.T) {
+		amounts, err := Compute(100, Equal, users(1, 2, 3))
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{33.34, 33.33, 33.33}, amounts)
+	})
+
+	t.Run("Exact must add up", func(t *testing.T) {
+		_, err := Compute(50, Exact, []Participant{{UserID: 1, Amount: 20}, {UserID: 2, Amount: 20}})
+		assert.Error(t, err)
+
+		amounts, err := Compute(50, Exact, []Participant{{UserID: 1, Amount: 20}, {UserID: 2, Amount: 30}})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{20, 30}, amounts)
+	})
+
+	t.Run("Percent", func(t *testing.T) {
+		amounts, err := Compute(200, Percent, []Participant{{UserID: 1, Percent: 25}, {UserID: 2, Percent: 75}})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{50, 150}, amounts)
+
+		_, err = Compute(200, Percent, []Participant{{UserID: 1, Percent: 25}, {UserID: 2, Percent: 70}})
+		assert.Error(t, err)
+	})
+
+	t.Run("Shares", func(t *testing.T) {
+		amounts, err := Compute(10, Shares, []Participant{{UserID: 1, Shares: 1}, {UserID: 2, Shares: 2}})
+		assert.NoError(t, err)
+		assert.Equal(t, []float64{3.33, 6.67}, amounts)
+	})
+
+	t.Run("Duplicate participant", func(t *testing.T) {
+		_, err := Compute(10, Equal, users(1, 1))
+		assert.Error(t, err)
+	})
+}
+
+func TestSimplify(t *testing.T) {
+	t.Run("Chain collapses", func(t *testing.T) {
+		// 1 owes 2 ten, 2 owes 3 ten: 1 should pay 3 directly
+		transfers := Simplify(map[uint]float64{1: -10, 2: 0, 3: 10})
+		assert.Equal(t, []Transfer{{FromUserID: 1, ToUserID: 3, Amount: 10}}, transfers)
+	})
+
+	t.Run("At most n-1 transfers", func(t *testing.T) {
+		transfers := Simplify(map[uint]float64{1: -30, 2: -20, 3: 25, 4: 25})
+		assert.LessOrEqual(t, len(transfers), 3)
+
+		nets := map[uint]float64{}
+		for _, tr := range transfers {
+			nets[tr.FromUserID] += tr.Amount
+			nets[tr.ToUserID] -= tr.Amount
+		}
+		assert.InDelta(t, 30, nets[1], 0.001)
+		assert.InDelta(t, 20, nets[2], 0.001)
+		assert.InDelta(t, -25, nets[3], 0.001)
+		assert.InDelta(t, -25, nets[4], 0.001)
+	})
+
+	t.Run("Already settled", func(t *testing.T) {
+		assert.Empty(t, Simplify(map[uint]float64{1: 0, 2: 0.001}))
+	})
+}
@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"os"
+)
+
+var ErrSealed = errors.New("TOTP secret could not be decrypted")
+
+// encryptionKey derives the AES key from TOTP_ENCRYPTION_KEY, falling back
+// to JWT_SECRET.
+func encryptionKey() []byte {
+	secret := os.Getenv("TOTP_ENCRYPTION_KEY")
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	key := sha256.Sum256([]byte(secret))
+	return key[:]
+}
+
+// Seal encrypts a secret for storage, so a database dump alone does not
+// yield working codes.
+func Seal(secret string) (string, error) {
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+// Open reverses Seal.
+func Open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", ErrSealed
+	}
+	gcm, err := newGCM()
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", ErrSealed
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrSealed
+	}
+	return string(plain), nil
+}
+
+func newGCM() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(encryptionKey())
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,75 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 appendix B, SHA-1, truncated to 6 digits
+func TestCodeMatchesRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		code, err := Code(secret, Step(time.Unix(unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, want, code, "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := GenerateSecret()
+	now := time.Unix(1700000000, 0)
+
+	code, _ := Code(secret, Step(now))
+	step, ok := Validate(secret, code, now, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Step(now), step)
+
+	// One step of drift is tolerated
+	_, ok = Validate(secret, code, now.Add(Period*time.Second), 0)
+	assert.True(t, ok)
+	_, ok = Validate(secret, code, now.Add(3*Period*time.Second), 0)
+	assert.False(t, ok)
+
+	// A code cannot be used twice
+	_, ok = Validate(secret, code, now, step)
+	assert.False(t, ok)
+
+	_, ok = Validate(secret, "12345", now, 0)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("SpendWise", "user@example.com", "JBSWY3DPEHPK3PXP")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/SpendWise:user@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=SpendWise")
+}
+
+func TestSeal(t *testing.T) {
+	t.Setenv("TOTP_ENCRYPTION_KEY", "test-key")
+
+	sealed, err := Seal("JBSWY3DPEHPK3PXP")
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, "JBSWY3DPEHPK3PXP")
+
+	secret, err := Open(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", secret)
+
+	t.Setenv("TOTP_ENCRYPTION_KEY", "other-key")
+	_, err = Open(sealed)
+	assert.ErrorIs(t, err, ErrSealed)
+}
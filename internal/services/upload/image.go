@@ -0,0 +1,180 @@
+package upload
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	return rgba
+}
+
+// flatten puts the image on a white background, for JPEG output.
+func flatten(img *image.RGBA) *image.RGBA {
+	out := image.NewRGBA(img.Rect)
+	draw.Draw(out, out.Rect, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(out, out.Rect, img, image.Point{}, draw.Over)
+	return out
+}
+
+// cropSquare cuts the largest centered square out of img.
+func cropSquare(img *image.RGBA) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	side := min(w, h)
+	x0, y0 := (w-side)/2, (h-side)/2
+	return toRGBA(img.SubImage(image.Rect(x0, y0, x0+side, y0+side)))
+}
+
+// fit scales img down to fit within size x size, keeping its aspect ratio.
+// Smaller images are returned unchanged.
+func fit(img *image.RGBA, size int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		return resize(img, size, max(1, h*size/w))
+	}
+	return resize(img, max(1, w*size/h), size)
+}
+
+// resize scales img to w x h. Each output pixel averages the source pixels
+// it covers (a box filter), which keeps downscaled receipts legible.
+func resize(img *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := img.Rect.Dx(), img.Rect.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		sy0 := y * sh / h
+		sy1 := max(sy0+1, (y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			sx0 := x * sw / w
+			sx1 := max(sx0+1, (x+1)*sw/w)
+
+			var r, g, b, a, n uint64
+			for sy := sy0; sy < sy1; sy++ {
+				row := img.Pix[sy*img.Stride:]
+				for sx := sx0; sx < sx1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+
+			d := out.Pix[y*out.Stride+x*4 : y*out.Stride+x*4+4]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return out
+}
+
+// orient turns a JPEG as its EXIF orientation tag (1-8) says, since that
+// tag is lost when the metadata is stripped.
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	ow, oh := w, h
+	if orientation >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < w; sx++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored
+				dx, dy = w-1-sx, sy
+			case 3: // Upside down
+				dx, dy = w-1-sx, h-1-sy
+			case 4:
+				dx, dy = sx, h-1-sy
+			case 5:
+				dx, dy = sy, sx
+			case 6: // Rotated 90° clockwise to display
+				dx, dy = h-1-sy, sx
+			case 7:
+				dx, dy = h-1-sy, w-1-sx
+			case 8: // Rotated 90° counter-clockwise to display
+				dx, dy = sy, w-1-sx
+			default:
+				dx, dy = sx, sy
+			}
+			copy(out.Pix[dy*out.Stride+dx*4:dy*out.Stride+dx*4+4], img.Pix[sy*img.Stride+sx*4:sy*img.Stride+sx*4+4])
+		}
+	}
+	return out
+}
+
+// jpegOrientation reads the orientation tag from a JPEG's EXIF block, or
+// returns 1 if there is none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // Image data starts
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < entries; e++ {
+		entry := ifd + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+	return 1
+}
@@ -0,0 +1,233 @@
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path"
+
+	"spendwise-backend/internal/storage"
+)
+
+// Kind selects the policy and processing applied to an upload.
+type Kind string
+
+const (
+	Attachment Kind = "attachment" // Receipts: images or PDFs, with a thumbnail
+	Slip       Kind = "slip"       // Payment slips: images only
+	Avatar     Kind = "avatar"     // Profile pictures: cropped square and resized
+)
+
+// Policy limits what may be uploaded for a kind.
+type Policy struct {
+	MaxSize int64
+	Allowed []string // Sniffed content types
+}
+
+var Policies = map[Kind]Policy{
+	Attachment: {MaxSize: 10 << 20, Allowed: []string{"image/jpeg", "image/png", "image/gif", "application/pdf"}},
+	Slip:       {MaxSize: 5 << 20, Allowed: []string{"image/jpeg", "image/png"}},
+	Avatar:     {MaxSize: 5 << 20, Allowed: []string{"image/jpeg", "image/png", "image/gif"}},
+}
+
+const (
+	// MaxPixels guards against decompression bombs.
+	MaxPixels = 40_000_000
+
+	ThumbnailSize = 320
+)
+
+// AvatarSizes are the square sizes avatars are stored in; the first is the
+// main image and the others are variants named by their size.
+var AvatarSizes = []int{256, 64}
+
+// AvatarKeys returns the storage key of an avatar followed by the keys of
+// its smaller sizes, which are stored next to it.
+func AvatarKeys(key string) []string {
+	keys := []string{key}
+	for _, size := range AvatarSizes[1:] {
+		keys = append(keys, storage.VariantKey(key, fmt.Sprint(size), path.Ext(key)))
+	}
+	return keys
+}
+
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("file type is not allowed")
+	ErrInvalidImage    = errors.New("image could not be read")
+)
+
+var extensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"application/pdf": ".pdf",
+}
+
+// Object is one processed file ready to be stored.
+type Object struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Result is a validated upload plus derived images, keyed by variant name
+// (e.g. "thumb" or "64").
+type Result struct {
+	Object
+	Variants map[string]Object
+}
+
+// Process validates an upload against the policy of its kind and prepares
+// it for storage: images are re-encoded without metadata (applying the EXIF
+// orientation first), avatars are cropped and resized and receipt images
+// get a thumbnail. The client's filename and content type are ignored.
+func Process(kind Kind, r io.Reader) (*Result, error) {
+	policy, ok := Policies[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown upload kind %q", kind)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, policy.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > policy.MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	if !allowed(policy, contentType) {
+		return nil, ErrUnsupportedType
+	}
+
+	result := &Result{
+		Object:   Object{Data: data, ContentType: contentType, Ext: extensions[contentType]},
+		Variants: map[string]Object{},
+	}
+	if contentType == "application/pdf" {
+		return result, nil
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	switch kind {
+	case Avatar:
+		return processAvatar(data, contentType)
+	default:
+		return processImage(result, kind == Attachment)
+	}
+}
+
+func allowed(policy Policy, contentType string) bool {
+	for _, t := range policy.Allowed {
+		if t == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// processImage strips metadata by re-encoding the image in its own format.
+func processImage(result *Result, thumbnail bool) (*Result, error) {
+	var img image.Image
+	switch result.ContentType {
+	case "image/gif":
+		// Keep animations; re-encoding drops comments and extensions
+		anim, err := gif.DecodeAll(bytes.NewReader(result.Data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, err
+		}
+		result.Data = buf.Bytes()
+		img = anim.Image[0]
+	default:
+		decoded, err := decode(result.Data, result.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		if result.Data, err = encode(decoded, result.ContentType); err != nil {
+			return nil, err
+		}
+		img = decoded
+	}
+
+	if thumbnail {
+		data, err := encode(flatten(fit(toRGBA(img), ThumbnailSize)), "image/jpeg")
+		if err != nil {
+			return nil, err
+		}
+		result.Variants["thumb"] = Object{Data: data, ContentType: "image/jpeg", Ext: ".jpg"}
+	}
+	return result, nil
+}
+
+// processAvatar center-crops to a square and stores every AvatarSizes size.
+// Animated GIFs keep only their first frame, as PNG.
+func processAvatar(data []byte, contentType string) (*Result, error) {
+	img, err := decode(data, contentType)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "image/gif" {
+		contentType = "image/png"
+	}
+	square := cropSquare(toRGBA(img))
+
+	result := &Result{Variants: map[string]Object{}}
+	for i, size := range AvatarSizes {
+		encoded, err := encode(resize(square, size, size), contentType)
+		if err != nil {
+			return nil, err
+		}
+		obj := Object{Data: encoded, ContentType: contentType, Ext: extensions[contentType]}
+		if i == 0 {
+			result.Object = obj
+		} else {
+			result.Variants[fmt.Sprint(size)] = obj
+		}
+	}
+	return result, nil
+}
+
+func decode(data []byte, contentType string) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if contentType == "image/jpeg" {
+		if o := jpegOrientation(data); o > 1 {
+			img = orient(toRGBA(img), o)
+		}
+	}
+	return img, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 88})
+	case "image/png":
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("cannot encode %s", contentType)
+	}
+	return buf.Bytes(), err
+}
@@ -0,0 +1,139 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{0, 0, 255, 255}
+			if x < w/2 {
+				c = color.RGBA{255, 0, 0, 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// withExif inserts an APP1 segment with the given orientation and some
+// text standing in for GPS data right after the JPEG's SOI marker.
+func withExif(jpg []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)            // One entry
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)       // Orientation
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)            // SHORT
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)            // Count
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)  // Value
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)                    // Padding, no next IFD
+	tiff = append(tiff, []byte("GPS 13.7563N 100.5018E")...) // Private data
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, app1...)
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(img image.Image) []byte {
+	var buf bytes.Buffer
+	jpeg.Encode(&buf, img, nil)
+	return buf.Bytes()
+}
+
+func TestProcessRejects(t *testing.T) {
+	_, err := Process(Attachment, strings.NewReader("#!/bin/sh\nrm -rf /"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+
+	_, err = Process(Slip, strings.NewReader("%PDF-1.4\n%..."))
+	assert.ErrorIs(t, err, ErrUnsupportedType, "slips must be images")
+
+	big := make([]byte, Policies[Avatar].MaxSize+1)
+	_, err = Process(Avatar, bytes.NewReader(big))
+	assert.ErrorIs(t, err, ErrTooLarge)
+
+	// A PNG header claiming a huge image
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:], 50000)
+	binary.BigEndian.PutUint32(data[20:], 50000)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	_, err = Process(Attachment, bytes.NewReader(data))
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestProcessStripsExifAndAppliesOrientation(t *testing.T) {
+	original := withExif(encodeJPEG(testImage(40, 20)), 6)
+	assert.Equal(t, 6, jpegOrientation(original))
+
+	result, err := Process(Attachment, bytes.NewReader(original))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/jpeg", result.ContentType)
+	assert.Equal(t, ".jpg", result.Ext)
+	assert.False(t, bytes.Contains(result.Data, []byte("Exif")))
+	assert.False(t, bytes.Contains(result.Data, []byte("GPS")))
+
+	img, err := jpeg.Decode(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(20, 40), img.Bounds().Size(), "rotated upright")
+
+	// The red left half ends up on top after a clockwise turn
+	r, _, b, _ := img.At(10, 5).RGBA()
+	assert.Greater(t, r, b)
+}
+
+func TestProcessAttachmentThumbnail(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, testImage(1000, 500))
+
+	result, err := Process(Attachment, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", result.ContentType)
+
+	thumb, ok := result.Variants["thumb"]
+	assert.True(t, ok)
+	assert.Equal(t, "image/jpeg", thumb.ContentType)
+	img, err := jpeg.Decode(bytes.NewReader(thumb.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(ThumbnailSize, ThumbnailSize/2), img.Bounds().Size())
+}
+
+func TestProcessPDFPassesThrough(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n1 0 obj\n<<>>\nendobj\n")
+	result, err := Process(Attachment, bytes.NewReader(pdf))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", result.ContentType)
+	assert.Equal(t, pdf, result.Data)
+	assert.Empty(t, result.Variants)
+}
+
+func TestProcessAvatar(t *testing.T) {
+	result, err := Process(Avatar, bytes.NewReader(encodeJPEG(testImage(300, 200))))
+	assert.NoError(t, err)
+
+	img, err := jpeg.Decode(bytes.NewReader(result.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(256, 256), img.Bounds().Size())
+
+	small, ok := result.Variants["64"]
+	assert.True(t, ok)
+	img, err = jpeg.Decode(bytes.NewReader(small.Data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Pt(64, 64), img.Bounds().Size())
+}
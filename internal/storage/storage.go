@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Backend stores uploaded files under opaque object keys such as
+// "attachments/9f86d081884c7d65.jpg".
+type Backend interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// List calls fn for every object whose key starts with prefix.
+	List(ctx context.Context, prefix string, fn func(Object) error) error
+}
+
+// Object describes a stored object.
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Files is the backend used by the handlers, set up by Connect.
+var Files Backend
+
+// Connect selects the backend from STORAGE_BACKEND ("local" or "s3").
+func Connect() {
+	switch strings.ToLower(os.Getenv("STORAGE_BACKEND")) {
+	case "", "local":
+		root := os.Getenv("UPLOAD_DIR")
+		if root == "" {
+			root = "./uploads"
+		}
+		Files = NewLocal(root)
+		log.Printf("File storage: local disk at %s", root)
+	case "s3":
+		s3, err := NewS3FromEnv()
+		if err != nil {
+			log.Fatal("Failed to configure S3 storage. \n", err)
+		}
+		Files = s3
+		log.Printf("File storage: S3 bucket %s at %s", s3.Bucket, s3.Endpoint)
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q", os.Getenv("STORAGE_BACKEND"))
+	}
+}
+
+// NewKey returns a fresh random key under prefix. Only the extension of the
+// original filename is kept, so user input never ends up in paths.
+func NewKey(prefix, filename string) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return prefix + "/" + hex.EncodeToString(buf) + cleanExt(filename)
+}
+
+// VariantKey names a derived object, e.g. a thumbnail, after the key of
+// the original: "attachments/ab12.png" becomes "attachments/ab12_thumb.jpg".
+func VariantKey(key, name, ext string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "_" + name + ext
+}
+
+func cleanExt(filename string) string {
+	ext := strings.ToLower(path.Ext(filename))
+	if len(ext) < 2 || len(ext) > 10 {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
+
+// ValidKey rejects empty keys and keys that could escape the storage root.
+func ValidKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// WithLocalFile calls fn with a path on local disk holding the object, for
+// tools such as OCR that need a real file. Remote objects are downloaded to
+// a temporary file that is removed afterwards.
+func WithLocalFile(ctx context.Context, b Backend, key string, fn func(filePath string) error) error {
+	if local, ok := b.(*Local); ok {
+		filePath, err := local.Path(key)
+		if err != nil {
+			return err
+		}
+		return fn(filePath)
+	}
+
+	r, err := b.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	tmp, err := os.CreateTemp("", "upload-*"+cleanExt(key))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return fn(tmp.Name())
+}
@@ -0,0 +1,305 @@
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Errors maps JSON field names to what is wrong with them.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field + " " + e[field]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Normalizer is implemented by request types that clean up their input
+// (trimming, formatting) before being validated.
+type Normalizer interface {
+	Normalize()
+}
+
+// Password policy. bcrypt ignores everything after 72 bytes.
+const (
+	PasswordMinLength = 8
+	PasswordMaxBytes  = 72
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// Struct checks the `validate` tags of a struct (or pointer to one) and
+// returns Errors, or nil when everything passes. Rules are comma separated:
+//
+//	required    not empty; for pointers, not nil
+//	notblank    may be left out (nil pointer) but not sent empty
+//	email       an address such as user@example.com
+//	password    PasswordMinLength+ characters with a letter and a digit
+//	phone       an E.164 number such as +66812345678
+//	min=N max=N length of strings and slices, or bounds of numbers
+//	gt=N        numbers greater than N
+//	oneof=a b   one of the listed values
+//
+// Empty values and nil pointers skip every rule but required. Nested
+// structs and slices of structs are checked too, with paths such as
+// "splits[0].amount".
+func Struct(v interface{}) error {
+	errs := Errors{}
+	checkStruct(reflect.ValueOf(v), "", errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func checkStruct(v reflect.Value, prefix string, errs Errors) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + fieldName(field)
+		value := v.Field(i)
+
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			if msg := checkField(value, tag); msg != "" {
+				errs[name] = msg
+				continue
+			}
+		}
+		checkNested(value, name, errs)
+	}
+}
+
+func checkNested(v reflect.Value, name string, errs Errors) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type().PkgPath() == "time" {
+			return
+		}
+		checkStruct(v, name+".", errs)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			checkNested(v.Index(i), fmt.Sprintf("%s[%d]", name, i), errs)
+		}
+	}
+}
+
+func fieldName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" && name != "-" {
+		return name
+	}
+	return field.Name
+}
+
+// checkField applies the rules of one field and returns the first failure.
+func checkField(v reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			for _, rule := range rules {
+				if rule == "required" {
+					return "is required"
+				}
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+
+	if isEmpty(v) {
+		for _, rule := range rules {
+			switch rule {
+			case "required":
+				return "is required"
+			case "notblank":
+				return "cannot be blank"
+			}
+		}
+		return ""
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		if msg := checkRule(v, name, arg); msg != "" {
+			return msg
+		}
+	}
+	return ""
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Bool:
+		return false // false is a valid answer, not a missing one
+	}
+	return v.IsZero()
+}
+
+func checkRule(v reflect.Value, rule, arg string) string {
+	switch rule {
+	case "required", "notblank":
+		return ""
+	case "email":
+		if !Email(v.String()) {
+			return "must be a valid email address"
+		}
+	case "password":
+		if msg := Password(v.String()); msg != "" {
+			return msg
+		}
+	case "phone":
+		if !Phone(v.String()) {
+			return "must be a phone number in international format, such as +66812345678"
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		got := fmt.Sprint(v.Interface())
+		for _, a := range allowed {
+			if a == got {
+				return ""
+			}
+		}
+		return "must be one of: " + strings.Join(allowed, ", ")
+	case "min", "max", "gt":
+		return checkBound(v, rule, arg)
+	default:
+		panic(fmt.Sprintf("validation: unknown rule %q", rule))
+	}
+	return ""
+}
+
+func checkBound(v reflect.Value, rule, arg string) string {
+	bound, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validation: bad bound %q for %s", arg, rule))
+	}
+
+	var n float64
+	length := false
+	switch v.Kind() {
+	case reflect.String:
+		n, length = float64(utf8.RuneCountInString(v.String())), true
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n, length = float64(v.Len()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	default:
+		panic(fmt.Sprintf("validation: %s does not apply to %s", rule, v.Kind()))
+	}
+
+	switch {
+	case rule == "min" && n < bound && length && v.Kind() == reflect.String:
+		return fmt.Sprintf("must be at least %s characters", arg)
+	case rule == "min" && n < bound && length:
+		return fmt.Sprintf("must have at least %s items", arg)
+	case rule == "min" && n < bound:
+		return "must be at least " + arg
+	case rule == "max" && n > bound && length && v.Kind() == reflect.String:
+		return fmt.Sprintf("must be at most %s characters", arg)
+	case rule == "max" && n > bound && length:
+		return fmt.Sprintf("must have at most %s items", arg)
+	case rule == "max" && n > bound:
+		return "must be at most " + arg
+	case rule == "gt" && n <= bound:
+		return "must be greater than " + arg
+	}
+	return ""
+}
+
+// Email accepts a bare address (no display name) with a dotted domain.
+func Email(s string) bool {
+	if len(s) > 254 {
+		return false
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return false
+	}
+	at := strings.LastIndex(s, "@")
+	domain := s[at+1:]
+	return strings.Contains(domain, ".") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+// Password returns what is wrong with a password, or "" when it passes the
+// policy.
+func Password(s string) string {
+	if utf8.RuneCountInString(s) < PasswordMinLength {
+		return fmt.Sprintf("must be at least %d characters", PasswordMinLength)
+	}
+	if len(s) > PasswordMaxBytes {
+		return fmt.Sprintf("must be at most %d bytes", PasswordMaxBytes)
+	}
+
+	var letter, digit bool
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !letter || !digit {
+		return "must contain at least one letter and one digit"
+	}
+	return ""
+}
+
+// Phone accepts E.164 numbers.
+func Phone(s string) bool {
+	return e164.MatchString(s)
+}
+
+// NormalizePhone strips the spaces, dashes, dots and parentheses people
+// type into phone numbers; "+66 81-234 5678" becomes "+66812345678".
+func NormalizePhone(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+}
@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type signup struct {
+	Email    string  `json:"email" validate:"required,email,max=255"`
+	Password string  `json:"password" validate:"required,password"`
+	FullName string  `json:"full_name" validate:"required,max=100"`
+	Phone    string  `json:"phone" validate:"phone"`
+	Amount   float64 `json:"amount" validate:"gt=0"`
+	Kind     string  `json:"kind" validate:"oneof=a b"`
+	Note     *string `json:"note" validate:"max=5"`
+	Nick     *string `json:"nick" validate:"notblank"`
+	Lines    []line  `json:"lines"`
+}
+
+type line struct {
+	Amount float64 `json:"amount" validate:"required,gt=0"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := signup{Email: "user@example.com", Password: "secret123", FullName: "User", Phone: "+66812345678", Amount: 5, Kind: "a"}
+	assert.NoError(t, Struct(&valid))
+
+	note, blank := "too long", " "
+	err := Struct(signup{
+		Nick:     &blank,
+		Email:    "not-an-email",
+		Password: "short",
+		Phone:    "0812345678",
+		Amount:   -1,
+		Kind:     "c",
+		Note:     &note,
+		Lines:    []line{{Amount: 1}, {Amount: 0}},
+	})
+	errs, ok := err.(Errors)
+	if assert.True(t, ok) {
+		assert.Equal(t, Errors{
+			"email":           "must be a valid email address",
+			"password":        "must be at least 8 characters",
+			"full_name":       "is required",
+			"phone":           "must be a phone number in international format, such as +66812345678",
+			"amount":          "must be greater than 0",
+			"kind":            "must be one of: a, b",
+			"note":            "must be at most 5 characters",
+			"nick":            "cannot be blank",
+			"lines[1].amount": "is required",
+		}, errs)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	for _, ok := range []string{"a@example.com", "first.last+tag@sub.example.co.th"} {
+		assert.True(t, Email(ok), ok)
+	}
+	for _, bad := range []string{"", "a", "a@b", "A <a@example.com>", "a@example.com ", "a@.com", "a@example."} {
+		assert.False(t, Email(bad), bad)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	assert.Empty(t, Password("password123"))
+	assert.NotEmpty(t, Password("password"))
+	assert.NotEmpty(t, Password("12345678"))
+	assert.NotEmpty(t, Password("a1"))
+	assert.NotEmpty(t, Password("a1"+string(make([]byte, 80))))
+}
+
+func TestPhone(t *testing.T) {
+	assert.True(t, Phone("+66812345678"))
+	assert.True(t, Phone(NormalizePhone(" +66 (81) 234-5678 ")))
+	assert.False(t, Phone("0812345678"))
+	assert.False(t, Phone("+0812345678"))
+	assert.False(t, Phone("+1234567890123456"))
+}